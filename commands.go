@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/logger"
+	"github.com/readr-media/readr-restful-following/pkg/following/model"
+)
+
+// commands are maintenance tasks run instead of the server, e.g. `app -path config reconcile -dry-run`
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"reconcile": reconcileCommand,
+	"cleanup":   cleanupCommand,
+	"export":    exportCommand,
+	"erase":     eraseCommand,
+	"merge":     mergeCommand,
+}
+
+// reconcileCommand repairs follow_counters rows that drifted from the following table
+func reconcileCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Only report drifted counters.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	drifts, err := model.ReconcileCounters(ctx, *dryRun)
+	for _, d := range drifts {
+		fmt.Printf("type=%d target_id=%d emotion=%d stored=%d actual=%d\n", d.Type, d.TargetID, d.Emotion, d.Stored, d.Actual)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Log.WithField("dry_run", *dryRun).Infof("Found %d drifted follow counters", len(drifts))
+	return nil
+}
+
+// cleanupCommand removes follows of missing or deactivated targets and members, defaulting to the cleanup config
+func cleanupCommand(ctx context.Context, args []string) error {
+	conf := config.Current().Cleanup
+	fs := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Only report orphaned follows.")
+	archive := fs.Bool("archive", conf.Archive, "Copy orphaned follows to following_archive before deleting.")
+	inactive := fs.Bool("inactive", conf.Inactive, "Also clean follows of deactivated targets and members.")
+	batch := fs.Int("batch", conf.BatchSize, "Follows removed per transaction.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	reports, err := model.CleanupOrphans(ctx, model.CleanupArgs{DryRun: *dryRun, Inactive: *inactive, Archive: *archive, BatchSize: *batch})
+	for _, r := range reports {
+		fmt.Printf("resource=%s reason=%s count=%d\n", r.Resource, r.Reason, r.Count)
+	}
+	return err
+}
+
+// exportCommand writes all follow data of a member to stdout as JSON or CSV
+func exportCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	member := fs.Int64("member", 0, "Member ID.")
+	format := fs.String("format", "json", "Output format, json or csv.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *member <= 0 {
+		return errors.New("Bad Member ID")
+	}
+
+	export, err := model.FollowingAPI.ExportMember(ctx, *member)
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(export)
+	case "csv":
+		return export.WriteCSV(os.Stdout)
+	default:
+		return errors.New("Unsupported Format")
+	}
+}
+
+// eraseCommand deletes the follow data of a member and prints the erasure receipt
+func eraseCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("erase", flag.ContinueOnError)
+	member := fs.Int64("member", 0, "Member ID.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *member <= 0 {
+		return errors.New("Bad Member ID")
+	}
+
+	receipt, err := model.FollowingAPI.EraseMember(ctx, *member)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(receipt)
+}
+
+// mergeCommand moves the follows of one member into another and prints what changed
+func mergeCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	source := fs.Int64("source", 0, "Member ID merged away.")
+	target := fs.Int64("target", 0, "Member ID kept.")
+	dryRun := fs.Bool("dry-run", false, "Only report what the merge would change.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := model.FollowingAPI.MergeMember(ctx, model.MergeArgs{Source: *source, Target: *target, DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -28,11 +28,68 @@ type AppConfig struct {
 		PostType              map[string]int `mapstructure:"post_type"`
 		PostPublishStatus     map[string]int `mapstructure:"post_publish_status"`
 		ProjectsActive        map[string]int `mapstructure:"projects_active"`
+		ProjectsStatus        map[string]int `mapstructure:"projects_status"`
 		ProjectsPublishStatus map[string]int `mapstructure:"projects_publish_status"`
+		Memos                 map[string]int `mapstructure:"memos"`
+		MemosPublishStatus    map[string]int `mapstructure:"memos_publish_status"`
+		Reports               map[string]int `mapstructure:"reports"`
+		ReportsPublishStatus  map[string]int `mapstructure:"reports_publish_status"`
+		Tags                  map[string]int `mapstructure:"tags"`
 		FollowingType         map[string]int `mapstructure:"following_type"`
 		Emotions              map[string]int `mapstructure:"emotions"`
+		FollowVisibility      map[string]int `mapstructure:"follow_visibility"`
 	} `mapstructure:"models"`
 
+	Server struct {
+		Port            string `mapstructure:"port"`
+		ShutdownDelay   int    `mapstructure:"shutdown_delay"`
+		ShutdownTimeout int    `mapstructure:"shutdown_timeout"`
+	} `mapstructure:"server"`
+
+	// TargetValidation checks follow targets before insert, per resource:
+	// "exists" in its table, "available" i.e. also active and published, or "skip"
+	TargetValidation map[string]string `mapstructure:"target_validation"`
+
+	// Privacy.CountPrivate counts private follows in followed counts, though they are not listed.
+	// Privacy.ViewerHeader is the header the gateway sets to the authenticated member ID,
+	// who is shown their own private follows.
+	Privacy struct {
+		CountPrivate bool   `mapstructure:"count_private"`
+		ViewerHeader string `mapstructure:"viewer_header"`
+	} `mapstructure:"privacy"`
+
+	// Cleanup configures the orphan cleanup, which runs every Interval seconds if positive
+	Cleanup struct {
+		Interval  int  `mapstructure:"interval"`
+		BatchSize int  `mapstructure:"batch_size"`
+		Archive   bool `mapstructure:"archive"`
+		Inactive  bool `mapstructure:"inactive"`
+	} `mapstructure:"cleanup"`
+
+	// Admin.Token is the bearer token the /admin routes require, which are disabled while it is empty.
+	// Set it through READR_ADMIN_TOKEN rather than the file.
+	Admin struct {
+		Token string `mapstructure:"token"`
+	} `mapstructure:"admin"`
+
+	Leaderboard struct {
+		CacheTTL  int `mapstructure:"cache_ttl"`
+		MaxResult int `mapstructure:"max_result"`
+	} `mapstructure:"leaderboard"`
+
+	Log struct {
+		Level string `mapstructure:"level"`
+	} `mapstructure:"log"`
+
+	// Tracing is disabled unless exporter is "stdout" or "otlp"
+	Tracing struct {
+		Exporter     string  `mapstructure:"exporter"`
+		OTLPEndpoint string  `mapstructure:"otlp_endpoint"`
+		OTLPInsecure bool    `mapstructure:"otlp_insecure"`
+		ServiceName  string  `mapstructure:"service_name"`
+		SampleRatio  float64 `mapstructure:"sample_ratio"`
+	} `mapstructure:"tracing"`
+
 	DomainName string `mapstructure:"domain_name"`
 }
 
@@ -76,5 +133,14 @@ func LoadConfig(configPath string) (conf AppConfig, err error) {
 		}
 	}
 
+	// Fail fast on inconsistent configuration instead of at request time
+	if err := Config.Validate(); err != nil {
+		return Config, err
+	}
+	loadedPath = configPath
+	if loadedPath == "" {
+		loadedPath = viper.ConfigFileUsed()
+	}
+	setCurrent(Config)
 	return Config, nil
 }
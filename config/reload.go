@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+var (
+	// current holds the *AppConfig served to request-time readers. It is swapped
+	// as a whole on reload, so a request never sees a half-updated config.
+	current atomic.Value
+
+	// loadedPath is the file LoadConfig read, which reloads read again
+	loadedPath string
+
+	// reloadMu serializes reloads, so a file change and a SIGHUP never parse at the same time
+	reloadMu sync.Mutex
+)
+
+// Current returns the latest validated configuration.
+// Code running at request time should read enumerations such as FollowingType,
+// Emotions and PostType through Current rather than the Config variable.
+func Current() *AppConfig {
+	if c, ok := current.Load().(*AppConfig); ok {
+		return c
+	}
+	return &Config
+}
+
+func setCurrent(c AppConfig) {
+	current.Store(&c)
+}
+
+// Reload re-reads the configuration file, validates it and swaps it in.
+// On any error the previous configuration stays in effect.
+// Settings only used at startup, such as sql connection and server port, require a restart.
+//
+// Each reload parses with its own viper instance; the global viper is only used by LoadConfig at startup.
+func Reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	content, err := ioutil.ReadFile(loadedPath)
+	if err != nil {
+		return err
+	}
+	v := viper.New()
+	v.SetConfigType("json")
+	v.AutomaticEnv()
+	v.SetEnvPrefix("READR")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	if err := v.ReadConfig(bytes.NewBuffer(content)); err != nil {
+		return err
+	}
+
+	var conf AppConfig
+	if err := v.Unmarshal(&conf); err != nil {
+		return err
+	}
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	setCurrent(conf)
+	return nil
+}
+
+// Watch reloads the configuration whenever the file changes and
+// reports the outcome of every attempt to onReload, until ctx is done.
+// The directory is watched rather than the file, and the file is reloaded
+// whenever its resolved symlink target changes as well, so editors that replace
+// the file and ConfigMap updates that swap the ..data symlink are noticed too.
+func Watch(ctx context.Context, onReload func(err error)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	file := filepath.Clean(loadedPath)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return err
+	}
+	realFile, _ := filepath.EvalSymlinks(file)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				currentFile, _ := filepath.EvalSymlinks(file)
+				written := filepath.Clean(event.Name) == file && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				if written || (currentFile != "" && currentFile != realFile) {
+					realFile = currentFile
+					onReload(Reload())
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				onReload(err)
+			}
+		}
+	}()
+	return nil
+}
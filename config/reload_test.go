@@ -0,0 +1,123 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+
+	content, err := ioutil.ReadFile("main.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "main.json")
+
+	write := func(s string) {
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(string(content))
+	if _, err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	_, ok := Current().Models.Emotions["love"]
+	assert.False(t, ok)
+
+	t.Run("ValidChange", func(t *testing.T) {
+		write(strings.Replace(string(content), `"dislike": 2`, `"dislike": 2, "love": 3`, 1))
+		assert.NoError(t, Reload())
+		assert.Equal(t, 3, Current().Models.Emotions["love"])
+	})
+	t.Run("InvalidChangeKeepsPrevious", func(t *testing.T) {
+		write(strings.Replace(string(content), `"follow": 0`, `"follow": 9`, 1))
+		assert.Error(t, Reload())
+		assert.Equal(t, 0, Current().Models.Emotions["follow"])
+		assert.Equal(t, 3, Current().Models.Emotions["love"])
+	})
+	t.Run("WatchReloadsOnWrite", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		reloaded := make(chan error, 10)
+		if err := Watch(ctx, func(err error) { reloaded <- err }); err != nil {
+			t.Fatal(err)
+		}
+		write(strings.Replace(string(content), `"dislike": 2`, `"dislike": 2, "love": 4`, 1))
+		select {
+		case err := <-reloaded:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reload after file change")
+		}
+		// A SIGHUP reload at the same time must not race the watcher
+		assert.NoError(t, Reload())
+		assert.Equal(t, 4, Current().Models.Emotions["love"])
+	})
+}
+
+// TestWatchConfigMap swaps the ..data symlink the way kubelet updates a mounted ConfigMap,
+// which changes what main.json resolves to without any event for main.json itself
+func TestWatchConfigMap(t *testing.T) {
+
+	content, err := ioutil.ReadFile("main.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "configmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// version writes a ..<name> directory holding main.json and points ..data at it
+	version := func(name, s string) {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name, "main.json"), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(name, filepath.Join(dir, "..data_tmp")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	version("..v1", string(content))
+	path := filepath.Join(dir, "main.json")
+	if err := os.Symlink(filepath.Join("..data", "main.json"), path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan error, 10)
+	if err := Watch(ctx, func(err error) { reloaded <- err }); err != nil {
+		t.Fatal(err)
+	}
+	version("..v2", strings.Replace(string(content), `"dislike": 2`, `"dislike": 2, "love": 5`, 1))
+	select {
+	case err := <-reloaded:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after ConfigMap update")
+	}
+	assert.Equal(t, 5, Current().Models.Emotions["love"])
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationError lists every problem found in a configuration
+type ValidationError []string
+
+func (v ValidationError) Error() string {
+	return fmt.Sprintf("%d config problem(s): %s", len(v), strings.Join(v, "; "))
+}
+
+// requiredKeys are the enumeration keys the models look up at request time,
+// e.g. GetFollowMapArgs filters on members.active and post_publish_status.publish,
+// and member blocking and cascades look up following_type.member
+var requiredKeys = []struct {
+	name string
+	get  func(c *AppConfig) map[string]int
+	keys []string
+}{
+	{"models.members", func(c *AppConfig) map[string]int { return c.Models.Members }, []string{"active"}},
+	{"models.posts", func(c *AppConfig) map[string]int { return c.Models.Posts }, []string{"active"}},
+	{"models.post_publish_status", func(c *AppConfig) map[string]int { return c.Models.PostPublishStatus }, []string{"publish"}},
+	{"models.projects_active", func(c *AppConfig) map[string]int { return c.Models.ProjectsActive }, []string{"active"}},
+	{"models.projects_publish_status", func(c *AppConfig) map[string]int { return c.Models.ProjectsPublishStatus }, []string{"publish"}},
+	{"models.emotions", func(c *AppConfig) map[string]int { return c.Models.Emotions }, []string{"follow"}},
+	{"models.follow_visibility", func(c *AppConfig) map[string]int { return c.Models.FollowVisibility }, []string{"public", "private"}},
+	{"models.following_type", func(c *AppConfig) map[string]int { return c.Models.FollowingType }, []string{"post", "member"}},
+}
+
+// Validate checks the configuration for missing values and broken cross-references.
+// It reports all problems at once instead of stopping at the first one.
+func (c *AppConfig) Validate() error {
+	var problems ValidationError
+
+	if c.SQL.Host == "" {
+		problems = append(problems, "sql.host is empty")
+	}
+	if c.SQL.Port <= 0 || c.SQL.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("sql.port %d is out of range", c.SQL.Port))
+	}
+	if c.SQL.User == "" {
+		problems = append(problems, "sql.user is empty")
+	}
+
+	for _, resource := range sortedKeys(c.SQL.TableMeta) {
+		meta := c.SQL.TableMeta[resource]
+		if meta["table_name"] == "" {
+			problems = append(problems, fmt.Sprintf("sql.table_meta.%s.table_name is empty", resource))
+		}
+		if meta["primary_key"] == "" {
+			problems = append(problems, fmt.Sprintf("sql.table_meta.%s.primary_key is empty", resource))
+		}
+		if _, ok := c.Models.FollowingType[resource]; !ok {
+			problems = append(problems, fmt.Sprintf("sql.table_meta.%s has no models.following_type entry", resource))
+		}
+	}
+	for _, resource := range sortedKeys(c.Models.FollowingType) {
+		if _, ok := c.SQL.TableMeta[resource]; !ok {
+			problems = append(problems, fmt.Sprintf("models.following_type.%s has no sql.table_meta entry", resource))
+		}
+	}
+	problems = append(problems, duplicateValues("models.following_type", c.Models.FollowingType)...)
+	problems = append(problems, duplicateValues("models.emotions", c.Models.Emotions)...)
+	problems = append(problems, duplicateValues("models.follow_visibility", c.Models.FollowVisibility)...)
+
+	for _, r := range requiredKeys {
+		m := r.get(c)
+		for _, key := range r.keys {
+			if _, ok := m[key]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is missing", r.name, key))
+			}
+		}
+	}
+	if v, ok := c.Models.Emotions["follow"]; ok && v != 0 {
+		problems = append(problems, fmt.Sprintf("models.emotions.follow must be 0, got %d", v))
+	}
+	if len(c.Models.PostType) == 0 {
+		problems = append(problems, "models.post_type is empty")
+	}
+
+	for _, resource := range sortedKeys(c.TargetValidation) {
+		if _, ok := c.SQL.TableMeta[resource]; !ok {
+			problems = append(problems, fmt.Sprintf("target_validation.%s has no sql.table_meta entry", resource))
+		}
+		switch c.TargetValidation[resource] {
+		case "", "skip", "exists", "available":
+		default:
+			problems = append(problems, fmt.Sprintf("target_validation.%s %q is not one of skip, exists, available", resource, c.TargetValidation[resource]))
+		}
+	}
+
+	if c.Cleanup.Interval < 0 {
+		problems = append(problems, "cleanup.interval is negative")
+	}
+	if c.Cleanup.BatchSize < 0 {
+		problems = append(problems, "cleanup.batch_size is negative")
+	}
+
+	if c.Server.ShutdownDelay < 0 {
+		problems = append(problems, "server.shutdown_delay is negative")
+	}
+	// 0 would make Shutdown give up at once and drop in-flight pubsub pushes
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_timeout is not positive")
+	}
+	switch c.Tracing.Exporter {
+	case "", "none", "stdout", "otlp":
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter %q is not one of stdout, otlp", c.Tracing.Exporter))
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func sortedKeys(m interface{}) (keys []string) {
+	switch m := m.(type) {
+	case map[string]map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]int:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func duplicateValues(name string, m map[string]int) (problems []string) {
+	seen := make(map[int]string, len(m))
+	for _, key := range sortedKeys(m) {
+		if other, ok := seen[m[key]]; ok {
+			problems = append(problems, fmt.Sprintf("%s.%s and %s.%s share value %d", name, other, name, key, m[key]))
+			continue
+		}
+		seen[m[key]] = key
+	}
+	return problems
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+
+	valid := func() AppConfig {
+		var c AppConfig
+		c.SQL.Host, c.SQL.Port, c.SQL.User = "127.0.0.1", 3306, "root"
+		c.Server.ShutdownTimeout = 30
+		c.SQL.TableMeta = map[string]map[string]string{
+			"member": {"table_name": "members", "primary_key": "id"},
+			"post":   {"table_name": "posts", "primary_key": "post_id"},
+		}
+		c.Models.FollowingType = map[string]int{"member": 1, "post": 2}
+		c.Models.Emotions = map[string]int{"follow": 0, "like": 1}
+		c.Models.FollowVisibility = map[string]int{"public": 0, "private": 1}
+		c.Models.PostType = map[string]int{"review": 0}
+		c.Models.Members = map[string]int{"active": 1}
+		c.Models.Posts = map[string]int{"active": 1}
+		c.Models.PostPublishStatus = map[string]int{"publish": 2}
+		c.Models.ProjectsActive = map[string]int{"active": 1}
+		c.Models.ProjectsPublishStatus = map[string]int{"publish": 2}
+		return c
+	}
+
+	for _, tc := range []struct {
+		name     string
+		modify   func(c *AppConfig)
+		problems []string
+	}{
+		{"Valid", func(c *AppConfig) {}, nil},
+		{"ZeroPort", func(c *AppConfig) { c.SQL.Port = 0 }, []string{"sql.port 0 is out of range"}},
+		{"TableMetaWithoutFollowingType", func(c *AppConfig) {
+			c.SQL.TableMeta["tag"] = map[string]string{"table_name": "tags", "primary_key": "tag_id"}
+		}, []string{"sql.table_meta.tag has no models.following_type entry"}},
+		{"FollowingTypeWithoutTableMeta", func(c *AppConfig) { c.Models.FollowingType["tag"] = 6 }, []string{"models.following_type.tag has no sql.table_meta entry"}},
+		{"NonZeroFollowEmotion", func(c *AppConfig) { c.Models.Emotions["follow"] = 3 }, []string{"models.emotions.follow must be 0, got 3"}},
+		{"MissingFollowEmotion", func(c *AppConfig) { delete(c.Models.Emotions, "follow") }, []string{"models.emotions.follow is missing"}},
+		{"UnknownTargetValidation", func(c *AppConfig) {
+			c.TargetValidation = map[string]string{"post": "published", "tag": "exists"}
+		}, []string{`target_validation.post "published" is not one of skip, exists, available`, "target_validation.tag has no sql.table_meta entry"}},
+		{"NegativeCleanupInterval", func(c *AppConfig) { c.Cleanup.Interval = -60 }, []string{"cleanup.interval is negative"}},
+		{"MissingShutdownTimeout", func(c *AppConfig) { c.Server.ShutdownTimeout = 0 }, []string{"server.shutdown_timeout is not positive"}},
+		{"MissingPrivateVisibility", func(c *AppConfig) { delete(c.Models.FollowVisibility, "private") }, []string{"models.follow_visibility.private is missing"}},
+		{"MissingMemberFollowingType", func(c *AppConfig) {
+			delete(c.Models.FollowingType, "member")
+			delete(c.SQL.TableMeta, "member")
+		}, []string{"models.following_type.member is missing"}},
+		{"MultipleProblems", func(c *AppConfig) {
+			c.SQL.Host = ""
+			delete(c.Models.Members, "active")
+			c.Models.FollowingType["post"] = 1
+		}, []string{"sql.host is empty", "models.following_type.member and models.following_type.post share value 1", "models.members.active is missing"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := valid()
+			tc.modify(&c)
+			err := c.Validate()
+			if tc.problems == nil {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Equal(t, ValidationError(tc.problems), err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMainJSON(t *testing.T) {
+	_, err := LoadConfig("main.json")
+	assert.NoError(t, err)
+}
@@ -3,7 +3,9 @@ module github.com/readr-media/readr-restful-following
 go 1.14
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/PuerkitoBio/goquery v1.5.1
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/garyburd/redigo v1.6.0
 	github.com/gin-gonic/gin v1.6.2
 	github.com/go-sql-driver/mysql v1.5.0
@@ -12,7 +14,13 @@ require (
 	github.com/prometheus/client_golang v1.5.1
 	github.com/readr-media/readr-restful v0.0.0-20200410051838-6a83c68434af
 	github.com/readr-media/readr-restful-member v0.0.0-20200330033217-925b762bf60f
+	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/viper v1.6.3
-	github.com/stretchr/testify v1.4.0
-	golang.org/x/crypto v0.0.0-20200414173820-0848c9571904
+	github.com/stretchr/testify v1.7.0
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 )
@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader is read from incoming requests and echoed back in responses
+const RequestIDHeader = "X-Request-ID"
+
+// Log is the application logger, writing JSON lines to stdout
+var Log = logrus.New()
+
+type ctxKey struct{}
+
+func init() {
+	Log.SetOutput(os.Stdout)
+	Log.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+}
+
+// Init sets the log level, e.g. "debug", "info", "warn" or "error"
+func Init(level string) error {
+	if level == "" {
+		return nil
+	}
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	Log.SetLevel(lvl)
+	return nil
+}
+
+// FromContext returns the entry stored in ctx, carrying fields such as
+// request_id and message_id, or a bare entry if there is none.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if ctx != nil {
+		if entry, ok := ctx.Value(ctxKey{}).(*logrus.Entry); ok {
+			return entry
+		}
+	}
+	return logrus.NewEntry(Log)
+}
+
+// WithFields returns a copy of ctx whose logger entry has fields added
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	return context.WithValue(ctx, ctxKey{}, FromContext(ctx).WithFields(fields))
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestID reuses the incoming X-Request-ID or generates one, and stores
+// it in the request context so every log line of the request carries it.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(WithFields(c.Request.Context(), logrus.Fields{"request_id": id}))
+		c.Next()
+	}
+}
+
+// Middleware writes one access log line per request, skipping the given paths
+func Middleware(skip ...string) gin.HandlerFunc {
+	skipped := make(map[string]bool, len(skip))
+	for _, path := range skip {
+		skipped[path] = true
+	}
+	return func(c *gin.Context) {
+		if skipped[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+
+		entry := FromContext(c.Request.Context()).WithFields(logrus.Fields{
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"query":      c.Request.URL.RawQuery,
+			"status":     c.Writer.Status(),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":  c.ClientIP(),
+		})
+		if len(c.Errors) > 0 {
+			entry.Error(c.Errors.String())
+			return
+		}
+		entry.Info("request")
+	}
+}
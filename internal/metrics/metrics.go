@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+)
+
+const namespace = "following"
+
+var (
+	// FollowOperations counts follow, unfollow and emotion writes by resource and outcome
+	FollowOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_total",
+		Help:      "Follow, unfollow and emotion operations by resource, operation and outcome.",
+	}, []string{"resource", "operation", "outcome"})
+
+	// PubsubMessages counts received Pub/Sub push messages by type, action and result
+	PubsubMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pubsub_messages_total",
+		Help:      "Pub/Sub push messages by type, action and result.",
+	}, []string{"type", "action", "result"})
+
+	// QueryDuration observes the latency of each Get*Args query, including scanning
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "query_duration_seconds",
+		Help:      "Latency of following queries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"query"})
+
+	// QueryRows observes how many items each Get*Args query returns
+	QueryRows = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "query_rows",
+		Help:      "Number of items returned by following queries.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"query"})
+
+	// ConfigReloads counts configuration hot reload attempts by result
+	ConfigReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Configuration reload attempts by result.",
+	}, []string{"result"})
+
+	// ConfigLastReload is the unix time of the last successful configuration reload
+	ConfigLastReload = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Unix time of the last successful configuration reload.",
+	})
+
+	// OrphanFollows counts follows removed by the orphan cleanup by resource, reason and action
+	OrphanFollows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orphan_follows_total",
+		Help:      "Follows of missing or deactivated targets and members removed by the cleanup.",
+	}, []string{"resource", "reason", "action"})
+
+	// HTTPRequests counts handled HTTP requests per route
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration observes HTTP request latency per route
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		FollowOperations,
+		PubsubMessages,
+		OrphanFollows,
+		QueryDuration,
+		QueryRows,
+		ConfigReloads,
+		ConfigLastReload,
+		HTTPRequests,
+		HTTPDuration,
+	)
+}
+
+// ObserveQuery records latency since start and, when result is a slice, its length
+func ObserveQuery(query string, start time.Time, result interface{}) {
+	QueryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	if v := reflect.ValueOf(result); v.Kind() == reflect.Slice {
+		QueryRows.WithLabelValues(query).Observe(float64(v.Len()))
+	}
+}
+
+// ObserveConfigReload records the result of a configuration reload
+func ObserveConfigReload(err error) {
+	if err != nil {
+		ConfigReloads.WithLabelValues("failure").Inc()
+		return
+	}
+	ConfigReloads.WithLabelValues("success").Inc()
+	ConfigLastReload.SetToCurrentTime()
+}
+
+// Outcome maps an error to a bounded outcome label value
+func Outcome(err error) string {
+	switch err {
+	case nil:
+		return "success"
+	case rrsql.DuplicateError:
+		return "duplicate"
+	case rrsql.SQLInsertionFail, rrsql.SQLUpdateFail:
+		return "no_change"
+	case rrsql.TargetNotFoundError:
+		return "not_found"
+	case rrsql.BlockedError:
+		return "blocked"
+	default:
+		return "error"
+	}
+}
+
+// HTTPMiddleware records request count and latency labeled by the matched route pattern,
+// so path parameters do not blow up label cardinality.
+func HTTPMiddleware(skip ...string) gin.HandlerFunc {
+	skipped := make(map[string]bool, len(skip))
+	for _, path := range skip {
+		skipped[path] = true
+	}
+	return func(c *gin.Context) {
+		if skipped[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,242 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/readr-media/readr-restful-following/config"
+)
+
+var UnsupportedResource = errors.New("Unsupported Resource")
+
+// Resource describes a followable resource and how to filter its table
+type Resource struct {
+	Name       string
+	Table      string
+	PrimaryKey string
+	FollowType int
+
+	// ActiveColumn is empty if the table has no active flag.
+	// Actives lists its valid values, e.g. models.posts.
+	ActiveColumn string
+	Actives      map[string]int
+
+	// PublishColumn is empty if the table has no publish status.
+	// PublishStatuses lists its valid values, e.g. models.post_publish_status.
+	PublishColumn   string
+	PublishStatuses map[string]int
+
+	// TypeColumn is the sub-type column matched by resource_type, with Types as its values
+	TypeColumn string
+	Types      map[string]int
+
+	// Emotion reports whether like/dislike are available besides follow
+	Emotion bool
+
+	// TargetColumns maps the TargetFields a table has to its columns, e.g. "title": "title"
+	TargetColumns map[string]string
+
+	// URLSlug selects the slug utils.GenerateResourceInfo needs, empty if the URL only uses the ID
+	URLSlug string
+
+	// TargetCheck is the target_validation mode applied before a follow is inserted
+	TargetCheck string
+}
+
+// TargetFields are the optional sql.table_meta keys naming the columns returned with embed=target
+var TargetFields = []string{"title", "slug", "name", "hero_image"}
+
+// TypeValue returns the TypeColumn value of sub-type name, e.g. "review" for posts
+func (r Resource) TypeValue(name string) (int, bool) {
+	v, ok := r.Types[name]
+	return v, ok && r.TypeColumn != ""
+}
+
+// ActiveValue returns the value of ActiveColumn for an active row
+func (r Resource) ActiveValue() (int, bool) {
+	v, ok := r.Actives["active"]
+	return v, ok && r.ActiveColumn != ""
+}
+
+// PublishValue returns the value of PublishColumn for a published row
+func (r Resource) PublishValue() (int, bool) {
+	v, ok := r.PublishStatuses["publish"]
+	return v, ok && r.PublishColumn != ""
+}
+
+// schema holds what the config does not: the column layout of each table
+// and which models.* enumeration supplies its values.
+type schema struct {
+	activeColumn    string
+	actives         func(c *config.AppConfig) map[string]int
+	publishColumn   string
+	publishStatuses func(c *config.AppConfig) map[string]int
+	typeColumn      string
+	types           func(c *config.AppConfig) map[string]int
+	noEmotion       bool
+	// urlSlug is the slug column, unless sql.table_meta names one.
+	// With urlParent the URL uses the slug of the urlParent row that parentKey refers to.
+	urlSlug   string
+	urlParent string
+	parentKey string
+}
+
+var schemas = map[string]schema{
+	"member": {
+		activeColumn: "active",
+		actives:      func(c *config.AppConfig) map[string]int { return c.Models.Members },
+		noEmotion:    true,
+	},
+	"post": {
+		activeColumn:    "active",
+		actives:         func(c *config.AppConfig) map[string]int { return c.Models.Posts },
+		publishColumn:   "publish_status",
+		publishStatuses: func(c *config.AppConfig) map[string]int { return c.Models.PostPublishStatus },
+		typeColumn:      "type",
+		types:           func(c *config.AppConfig) map[string]int { return c.Models.PostType },
+	},
+	"project": {
+		activeColumn:    "active",
+		actives:         func(c *config.AppConfig) map[string]int { return c.Models.ProjectsActive },
+		publishColumn:   "publish_status",
+		publishStatuses: func(c *config.AppConfig) map[string]int { return c.Models.ProjectsPublishStatus },
+		typeColumn:      "status",
+		types:           func(c *config.AppConfig) map[string]int { return c.Models.ProjectsStatus },
+		urlSlug:         "slug",
+	},
+	"memo": {
+		activeColumn:    "active",
+		actives:         func(c *config.AppConfig) map[string]int { return c.Models.Memos },
+		publishColumn:   "publish_status",
+		publishStatuses: func(c *config.AppConfig) map[string]int { return c.Models.MemosPublishStatus },
+		typeColumn:      "publish_status",
+		types:           func(c *config.AppConfig) map[string]int { return c.Models.MemosPublishStatus },
+		// Memo URLs are under the series, i.e. the project, they belong to
+		urlParent: "project",
+		parentKey: "project_id",
+	},
+	"report": {
+		activeColumn:    "active",
+		actives:         func(c *config.AppConfig) map[string]int { return c.Models.Reports },
+		publishColumn:   "publish_status",
+		publishStatuses: func(c *config.AppConfig) map[string]int { return c.Models.ReportsPublishStatus },
+		typeColumn:      "publish_status",
+		types:           func(c *config.AppConfig) map[string]int { return c.Models.ReportsPublishStatus },
+		urlSlug:         "slug",
+	},
+	"tag": {
+		activeColumn: "active",
+		actives:      func(c *config.AppConfig) map[string]int { return c.Models.Tags },
+	},
+}
+
+type snapshot struct {
+	conf      *config.AppConfig
+	resources map[string]Resource
+}
+
+// cache is rebuilt whenever config.Current() returns a new config, e.g. after a hot reload
+var cache atomic.Value
+
+// Build combines sql.table_meta and models.following_type with the table schemas.
+// A resource needs both config entries to be followable; one without a schema entry
+// is followable but cannot be filtered by active, publish status or type.
+func Build(conf *config.AppConfig) map[string]Resource {
+	resources := make(map[string]Resource)
+	for name, meta := range conf.SQL.TableMeta {
+		followType, ok := conf.Models.FollowingType[name]
+		if !ok {
+			continue
+		}
+		r := Resource{
+			Name:       name,
+			Table:      meta["table_name"],
+			PrimaryKey: meta["primary_key"],
+			FollowType: followType,
+			Emotion:    true,
+		}
+		if check := conf.TargetValidation[name]; check != "skip" {
+			r.TargetCheck = check
+		}
+		for _, field := range TargetFields {
+			if column := meta[field]; column != "" {
+				if r.TargetColumns == nil {
+					r.TargetColumns = make(map[string]string)
+				}
+				r.TargetColumns[field] = column
+			}
+		}
+		if s, ok := schemas[name]; ok {
+			r.Emotion = !s.noEmotion
+			if s.urlSlug != "" {
+				r.URLSlug = s.urlSlug
+				if column := meta["slug"]; column != "" {
+					r.URLSlug = column
+				}
+			}
+			if s.actives != nil {
+				r.ActiveColumn, r.Actives = s.activeColumn, s.actives(conf)
+			}
+			if s.publishStatuses != nil {
+				r.PublishColumn, r.PublishStatuses = s.publishColumn, s.publishStatuses(conf)
+			}
+			if s.types != nil {
+				r.TypeColumn, r.Types = s.typeColumn, s.types(conf)
+			}
+		}
+		resources[name] = r
+	}
+	// Slugs of a parent resource are read through its registry entry, so table renames carry over
+	for name, r := range resources {
+		s := schemas[name]
+		if s.urlParent == "" {
+			continue
+		}
+		if parent, ok := resources[s.urlParent]; ok && parent.URLSlug != "" {
+			r.URLSlug = fmt.Sprintf("(SELECT p.%s FROM %s AS p WHERE p.%s = %s.%s)",
+				parent.URLSlug, parent.Table, parent.PrimaryKey, r.Table, s.parentKey)
+			resources[name] = r
+		}
+	}
+	return resources
+}
+
+func resources() map[string]Resource {
+	conf := config.Current()
+	if s, ok := cache.Load().(snapshot); ok && s.conf == conf {
+		return s.resources
+	}
+	s := snapshot{conf: conf, resources: Build(conf)}
+	cache.Store(s)
+	return s.resources
+}
+
+// Get returns the followable resource called name
+func Get(name string) (Resource, error) {
+	if r, ok := resources()[name]; ok {
+		return r, nil
+	}
+	return Resource{}, UnsupportedResource
+}
+
+// ByFollowType returns the resource stored with followType in following.type
+func ByFollowType(followType int) (Resource, error) {
+	for _, r := range resources() {
+		if r.FollowType == followType {
+			return r, nil
+		}
+	}
+	return Resource{}, UnsupportedResource
+}
+
+// Names lists all followable resources in alphabetical order
+func Names() []string {
+	names := make([]string, 0)
+	for name := range resources() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
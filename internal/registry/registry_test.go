@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/readr-media/readr-restful-following/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+
+	var conf config.AppConfig
+	conf.SQL.TableMeta = map[string]map[string]string{
+		"member":  {"table_name": "members", "primary_key": "id"},
+		"post":    {"table_name": "posts", "primary_key": "post_id", "title": "title", "hero_image": "og_image"},
+		"podcast": {"table_name": "podcasts", "primary_key": "podcast_id"},
+		"orphan":  {"table_name": "orphans", "primary_key": "id"},
+		"project": {"table_name": "series", "primary_key": "series_id", "slug": "series_slug"},
+		"memo":    {"table_name": "notes", "primary_key": "note_id"},
+	}
+	conf.Models.FollowingType = map[string]int{"member": 1, "post": 2, "podcast": 7, "project": 3, "memo": 4}
+	conf.Models.Members = map[string]int{"active": 1, "deactive": 0}
+	conf.Models.Posts = map[string]int{"active": 1}
+	conf.Models.PostPublishStatus = map[string]int{"publish": 2}
+	conf.Models.PostType = map[string]int{"review": 0, "news": 1}
+
+	resources := Build(&conf)
+
+	t.Run("MissingFollowingType", func(t *testing.T) {
+		_, ok := resources["orphan"]
+		assert.False(t, ok)
+	})
+	t.Run("Member", func(t *testing.T) {
+		r := resources["member"]
+		assert.Equal(t, "members", r.Table)
+		assert.False(t, r.Emotion)
+		v, ok := r.ActiveValue()
+		assert.True(t, ok)
+		assert.Equal(t, 1, v)
+		_, ok = r.PublishValue()
+		assert.False(t, ok)
+	})
+	t.Run("Post", func(t *testing.T) {
+		r := resources["post"]
+		assert.Equal(t, 2, r.FollowType)
+		assert.True(t, r.Emotion)
+		assert.Equal(t, "type", r.TypeColumn)
+		assert.Equal(t, 1, r.Types["news"])
+		v, ok := r.PublishValue()
+		assert.True(t, ok)
+		assert.Equal(t, 2, v)
+		assert.Equal(t, map[string]string{"title": "title", "hero_image": "og_image"}, r.TargetColumns)
+	})
+	t.Run("URLSlug", func(t *testing.T) {
+		// Renamed tables and slug columns in sql.table_meta carry over to the memo slug lookup
+		assert.Equal(t, "series_slug", resources["project"].URLSlug)
+		assert.Equal(t, "(SELECT p.series_slug FROM series AS p WHERE p.series_id = notes.project_id)", resources["memo"].URLSlug)
+		assert.Empty(t, resources["post"].URLSlug)
+	})
+	t.Run("WithoutSchema", func(t *testing.T) {
+		r := resources["podcast"]
+		assert.Equal(t, Resource{Name: "podcast", Table: "podcasts", PrimaryKey: "podcast_id", FollowType: 7, Emotion: true}, r)
+	})
+}
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+type healthHandler struct {
+	ready int32
+}
+
+// SetReady flips the readiness probe. It is set to false before shutdown
+// so load balancers stop routing new requests while in-flight ones drain.
+func (h *healthHandler) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&h.ready, v)
+}
+
+func (h *healthHandler) IsReady() bool {
+	return atomic.LoadInt32(&h.ready) == 1
+}
+
+func (h *healthHandler) Live(c *gin.Context) {
+	c.Status(http.StatusOK)
+}
+
+func (h *healthHandler) Ready(c *gin.Context) {
+	if !h.IsReady() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"Error": "Shutting Down"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (h *healthHandler) SetRoutes(router *gin.Engine) {
+	router.GET("/healthz", h.Live)
+	router.GET("/readyz", h.Ready)
+}
+
+var HealthRouter healthHandler
@@ -2,6 +2,8 @@ package rrsql
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
@@ -12,7 +14,9 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/golang-migrate/migrate/source/file"
 	"github.com/jmoiron/sqlx"
-	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/readr-media/readr-restful-following/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 )
 
 var DB database = database{nil}
@@ -33,6 +37,124 @@ func Connect(dbURI string) {
 	DB = database{d}
 }
 
+// traced runs one statement in a span carrying it, named sql.<op>
+func traced(ctx context.Context, op string, query string, fn func(ctx context.Context) error) error {
+	ctx, span := tracing.Start(ctx, "sql."+op, semconv.DBSystemMySQL, semconv.DBStatementKey.String(query))
+	err := fn(ctx)
+	tracing.End(span, err)
+	return err
+}
+
+// QueryxContext wraps sqlx.DB.QueryxContext in a span carrying the statement
+func (d database) QueryxContext(ctx context.Context, query string, args ...interface{}) (rows *sqlx.Rows, err error) {
+	err = traced(ctx, "query", query, func(ctx context.Context) error {
+		rows, err = d.DB.QueryxContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// ExecContext wraps sqlx.DB.ExecContext in a span carrying the statement
+func (d database) ExecContext(ctx context.Context, query string, args ...interface{}) (result sql.Result, err error) {
+	err = traced(ctx, "exec", query, func(ctx context.Context) error {
+		result, err = d.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// GetContext wraps sqlx.DB.GetContext in a span carrying the statement
+func (d database) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return traced(ctx, "query", query, func(ctx context.Context) error {
+		return d.DB.GetContext(ctx, dest, query, args...)
+	})
+}
+
+// SelectContext wraps sqlx.DB.SelectContext in a span carrying the statement
+func (d database) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return traced(ctx, "query", query, func(ctx context.Context) error {
+		return d.DB.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+// Tx is a transaction whose statements are traced like the ones run on DB
+type Tx struct {
+	*sqlx.Tx
+}
+
+// QueryxContext wraps sqlx.Tx.QueryxContext in a span carrying the statement
+func (t *Tx) QueryxContext(ctx context.Context, query string, args ...interface{}) (rows *sqlx.Rows, err error) {
+	err = traced(ctx, "query", query, func(ctx context.Context) error {
+		rows, err = t.Tx.QueryxContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// ExecContext wraps sqlx.Tx.ExecContext in a span carrying the statement
+func (t *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (result sql.Result, err error) {
+	err = traced(ctx, "exec", query, func(ctx context.Context) error {
+		result, err = t.Tx.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+// NamedExecContext wraps sqlx.Tx.NamedExecContext in a span carrying the statement
+func (t *Tx) NamedExecContext(ctx context.Context, query string, arg interface{}) (result sql.Result, err error) {
+	err = traced(ctx, "exec", query, func(ctx context.Context) error {
+		result, err = t.Tx.NamedExecContext(ctx, query, arg)
+		return err
+	})
+	return result, err
+}
+
+// GetContext wraps sqlx.Tx.GetContext in a span carrying the statement
+func (t *Tx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return traced(ctx, "query", query, func(ctx context.Context) error {
+		return t.Tx.GetContext(ctx, dest, query, args...)
+	})
+}
+
+// SelectContext wraps sqlx.Tx.SelectContext in a span carrying the statement
+func (t *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return traced(ctx, "query", query, func(ctx context.Context) error {
+		return t.Tx.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+// Transact runs fn in a transaction, which is committed if fn returns nil and rolled back otherwise.
+// Statements run through tx get their own spans under the sql.transaction span.
+func (d database) Transact(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	ctx, span := tracing.Start(ctx, "sql.transaction", semconv.DBSystemMySQL)
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := d.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	return fn(&Tx{tx})
+}
+
+// Close releases the connection pool opened by Connect
+func Close() error {
+	if DB.DB == nil {
+		return nil
+	}
+	return DB.DB.Close()
+}
+
 // func ValidateActive(args map[string][]int, status map[string]interface{}) (err error) {
 func ValidateActive(args map[string][]int, status map[string]int) (err error) {
 	if len(args) > 1 {
@@ -45,7 +167,6 @@ func ValidateActive(args map[string][]int, status map[string]int) (err error) {
 		// valid = append(valid, int(v.(float64)))
 		valid = append(valid, v)
 	}
-	log.Println("resukt", result)
 	activeCount := 0
 	for _, activeSlice := range args {
 		activeCount = len(activeSlice)
@@ -294,14 +415,9 @@ func GenerateSQLStmt(mode string, tableName string, input ...interface{}) (query
 }
 
 func GetResourceMetadata(resource string) (table, key string, followtype int, err error) {
-	if _, ok := config.Config.SQL.TableMeta[resource]; !ok {
-		return "", "", 0, errors.New("Unsupported Resource")
-	}
-
-	if _, ok := config.Config.Models.FollowingType[resource]; !ok {
-		return "", "", 0, errors.New("Unsupported Resource")
+	r, err := registry.Get(resource)
+	if err != nil {
+		return "", "", 0, err
 	}
-
-	meta := config.Config.SQL.TableMeta[resource]
-	return meta["table_name"], meta["primary_key"], config.Config.Models.FollowingType[resource], nil
+	return r.Table, r.PrimaryKey, r.FollowType, nil
 }
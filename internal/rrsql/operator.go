@@ -1,6 +1,10 @@
 package rrsql
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
 
 var allowOperator = map[string]string{
 	"$gte": ">=",
@@ -22,3 +26,69 @@ func OperatorCoverter(op string) (r string, err error) {
 	}
 	return r, nil
 }
+
+// Filter maps a field to operators and their values, parsed from JSON such as
+// {"created_at":{"$gte":"2020-01-01"},"target_id":{"$nin":[1,2]}}
+type Filter map[string]map[string]interface{}
+
+// Conditions converts the filter to WHERE conditions with "?" placeholders and their args.
+// fields whitelists the filterable fields and maps each to its column, e.g. "created_at" to "f.created_at".
+// $in and $nin take a non-empty array and need sqlx.In to expand it; the other operators take a single value.
+func (f Filter) Conditions(fields map[string]string) (conditions []string, args []interface{}, err error) {
+
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		column, ok := fields[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("Invalid Filter Field %s", name)
+		}
+		ops := make([]string, 0, len(f[name]))
+		for op := range f[name] {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+
+		for _, op := range ops {
+			sqlOp, err := OperatorCoverter(op)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Invalid Filter Operator %s", op)
+			}
+			value := f[name][op]
+			switch value := value.(type) {
+			case []interface{}:
+				if op != "$in" && op != "$nin" {
+					return nil, nil, fmt.Errorf("Invalid Filter Value For %s", op)
+				}
+				if len(value) == 0 {
+					return nil, nil, fmt.Errorf("Empty Filter Value For %s", op)
+				}
+				for _, v := range value {
+					if !isScalar(v) {
+						return nil, nil, fmt.Errorf("Invalid Filter Value For %s", op)
+					}
+				}
+				conditions = append(conditions, fmt.Sprintf("%s %s (?)", column, sqlOp))
+			default:
+				if op == "$in" || op == "$nin" || !isScalar(value) {
+					return nil, nil, fmt.Errorf("Invalid Filter Value For %s", op)
+				}
+				conditions = append(conditions, fmt.Sprintf("%s %s ?", column, sqlOp))
+			}
+			args = append(args, value)
+		}
+	}
+	return conditions, args, nil
+}
+
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case string, float64, bool, int, int64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package rrsql
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterConditions(t *testing.T) {
+
+	fields := map[string]string{"created_at": "f.created_at", "target_id": "f.target_id"}
+
+	for _, tc := range []struct {
+		name       string
+		filter     string
+		conditions []string
+		args       []interface{}
+		errormsg   string
+	}{
+		{"Empty", `{}`, nil, nil, ""},
+		{"Comparison", `{"created_at":{"$gte":"2020-01-01","$lt":"2020-02-01"}}`,
+			[]string{"f.created_at >= ?", "f.created_at < ?"}, []interface{}{"2020-01-01", "2020-02-01"}, ""},
+		{"InAndSortedFields", `{"target_id":{"$nin":[1,2]},"created_at":{"$gte":"2020-01-01"}}`,
+			[]string{"f.created_at >= ?", "f.target_id NOT IN (?)"}, []interface{}{"2020-01-01", []interface{}{float64(1), float64(2)}}, ""},
+		{"FieldNotWhitelisted", `{"member_id":{"$eq":1}}`, nil, nil, "Invalid Filter Field member_id"},
+		{"InjectedField", `{"1=1; DROP TABLE following; --":{"$eq":1}}`, nil, nil, "Invalid Filter Field 1=1; DROP TABLE following; --"},
+		{"UnknownOperator", `{"target_id":{"$like":1}}`, nil, nil, "Invalid Filter Operator $like"},
+		{"ArrayForScalarOperator", `{"target_id":{"$gt":[1]}}`, nil, nil, "Invalid Filter Value For $gt"},
+		{"ScalarForIn", `{"target_id":{"$in":1}}`, nil, nil, "Invalid Filter Value For $in"},
+		{"EmptyIn", `{"target_id":{"$in":[]}}`, nil, nil, "Empty Filter Value For $in"},
+		{"ObjectValue", `{"target_id":{"$eq":{"a":1}}}`, nil, nil, "Invalid Filter Value For $eq"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var f Filter
+			if err := json.Unmarshal([]byte(tc.filter), &f); err != nil {
+				t.Fatal(err)
+			}
+			conditions, args, err := f.Conditions(fields)
+			if tc.errormsg != "" {
+				assert.EqualError(t, err, tc.errormsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.conditions, conditions)
+			assert.Equal(t, tc.args, args)
+		})
+	}
+}
@@ -15,6 +15,8 @@ var (
 	DuplicateError           = errors.New("Duplicate Entry")
 	InternalServerError      = errors.New("Internal Server Error")
 	ItemNotFoundError        = errors.New("Item Not Found")
+	TargetNotFoundError      = errors.New("Target Not Found")
+	BlockedError             = errors.New("Blocked By Member")
 	MultipleRowAffectedError = errors.New("More Than One Rows Affected")
 
 	SQLInsertionFail = errors.New("SQL Insertion Fail")
@@ -54,6 +54,11 @@ func InitHttpTest() {
 }
 
 func GenericDoTest(tc GenericTestcase, t *testing.T, function interface{}) {
+	GenericDoTestWithHeader(tc, nil, t, function)
+}
+
+// GenericDoTestWithHeader is GenericDoTest sending header along, e.g. credentials
+func GenericDoTestWithHeader(tc GenericTestcase, header http.Header, t *testing.T, function interface{}) {
 	t.Run(tc.Name, func(t *testing.T) {
 		w := httptest.NewRecorder()
 		jsonStr := []byte{}
@@ -72,6 +77,11 @@ func GenericDoTest(tc GenericTestcase, t *testing.T, function interface{}) {
 		} else {
 			req.Header.Set("Content-Type", "application/json")
 		}
+		for key, values := range header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
 
 		r.ServeHTTP(w, req)
 
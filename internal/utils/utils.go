@@ -15,32 +15,15 @@ import (
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/registry"
 )
 
 func GetResourceTableInfo(resource string) (tableName string, idName string) {
-
-	switch resource {
-	case "post":
-		tableName = "posts"
-		idName = "post_id"
-	case "project":
-		tableName = "projects"
-		idName = "project_id"
-	case "memo":
-		tableName = "memos"
-		idName = "memo_id"
-	case "report":
-		tableName = "reports"
-		idName = "id"
-	case "tag":
-		tableName = "tags"
-		idName = "tag_id"
-	default:
-		tableName = ""
-		idName = ""
+	r, err := registry.Get(resource)
+	if err != nil {
+		return "", ""
 	}
-
-	return tableName, idName
+	return r.Table, r.PrimaryKey
 }
 
 func ParseResourceInfo(resourceString string) (resourceType string, resourceID string) {
@@ -62,7 +45,7 @@ func ParseResourceInfo(resourceString string) (resourceType string, resourceID s
 }
 
 func GenerateResourceInfo(resourceType string, resourceID int, slug string) (resourceString string) {
-	resStringPrefix := config.Config.DomainName
+	resStringPrefix := config.Current().DomainName
 	switch resourceType {
 	case "post":
 		return fmt.Sprintf("%s/post/%d", resStringPrefix, resourceID)
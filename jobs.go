@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/logger"
+	"github.com/readr-media/readr-restful-following/pkg/following/model"
+)
+
+// startCleanupJob runs the orphan cleanup every cleanup.interval seconds until ctx is done.
+// The other cleanup settings are read on each run, so they follow config reloads.
+func startCleanupJob(ctx context.Context) {
+	interval := config.Config.Cleanup.Interval
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				conf := config.Current().Cleanup
+				reports, err := model.CleanupOrphans(ctx, model.CleanupArgs{Inactive: conf.Inactive, Archive: conf.Archive, BatchSize: conf.BatchSize})
+				if err != nil {
+					logger.Log.WithError(err).Error("Scheduled orphan cleanup fail")
+					continue
+				}
+				for _, r := range reports {
+					if r.Count > 0 {
+						logger.Log.WithField("resource", r.Resource).WithField("reason", r.Reason).Infof("Cleaned %d orphaned follows", r.Count)
+					}
+				}
+			}
+		}
+	}()
+}
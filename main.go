@@ -1,26 +1,50 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/logger"
+	"github.com/readr-media/readr-restful-following/internal/metrics"
 	"github.com/readr-media/readr-restful-following/internal/router"
 	"github.com/readr-media/readr-restful-following/internal/rrsql"
+	"github.com/readr-media/readr-restful-following/internal/tracing"
+	"github.com/readr-media/readr-restful-following/pkg/following/model"
 	followingRouter "github.com/readr-media/readr-restful-following/pkg/following/router"
 )
 
 func setRoutes(rt *gin.Engine) {
 	for _, h := range []router.RouterHandler{
+		&router.HealthRouter,
 		&followingRouter.Router,
 		&followingRouter.PubsubRouter,
+		&followingRouter.AdminRouter,
 	} {
 		h.SetRoutes(rt)
 	}
 }
 
+// serverAddr keeps the behavior of gin's Run(): the PORT environment variable
+// wins over server.port in the config, and 8080 is the fallback.
+func serverAddr() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+	if config.Config.Server.Port != "" {
+		return ":" + config.Config.Server.Port
+	}
+	return ":8080"
+}
+
 func main() {
 
 	var configFile string
@@ -32,17 +56,42 @@ func main() {
 		panic(fmt.Errorf("Invalid application configuration: %s", err))
 	}
 
-	r := gin.New()
-	r.Use(gin.Recovery())
+	if err := logger.Init(config.Config.Log.Level); err != nil {
+		panic(fmt.Errorf("Invalid log level: %s", err))
+	}
 
-	// Set customed logger, specify routes skiped from logged
-	r.Use(gin.LoggerWithWriter(gin.DefaultWriter, "/metrics"))
+	shutdownTracing, err := tracing.Init()
+	if err != nil {
+		panic(fmt.Errorf("Invalid tracing configuration: %s", err))
+	}
 
 	// Include multiStatements=True for migration usage
-	dbURI := fmt.Sprintf("%s:%s@tcp(%s)/memberdb?parseTime=true&charset=utf8mb4&multiStatements=true", config.Config.SQL.User, config.Config.SQL.Password, fmt.Sprintf("%s:%v", config.Config.SQL.Host, config.Config.SQL.Port))
+	dbURI := fmt.Sprintf("%s:%s@tcp(%s)/memberdb?parseTime=true&charset=utf8mb4&multiStatements=true&group_concat_max_len=%d", config.Config.SQL.User, config.Config.SQL.Password, fmt.Sprintf("%s:%v", config.Config.SQL.Host, config.Config.SQL.Port), model.FollowerConcatLen)
 	// Init Mysql connections
 	rrsql.Connect(dbURI)
 
+	if flag.NArg() > 0 {
+		command, ok := commands[flag.Arg(0)]
+		if !ok {
+			panic(fmt.Errorf("Unknown command: %s", flag.Arg(0)))
+		}
+		err := command(context.Background(), flag.Args()[1:])
+		rrsql.Close()
+		if err != nil {
+			logger.Log.WithError(err).Fatalf("Command %s fail", flag.Arg(0))
+		}
+		return
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(tracing.Middleware("/metrics", "/healthz", "/readyz"))
+
+	// Set customed logger, specify routes skiped from logged
+	r.Use(logger.RequestID())
+	r.Use(logger.Middleware("/metrics", "/healthz", "/readyz"))
+	r.Use(metrics.HTTPMiddleware("/metrics", "/healthz", "/readyz"))
+
 	setRoutes(r)
 
 	// Implemented Prometheus metrics
@@ -52,6 +101,67 @@ func main() {
 		}
 	}())
 
-	r.Run()
+	srv := &http.Server{
+		Addr:    serverAddr(),
+		Handler: r,
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Log.WithError(err).Fatal("Listen error")
+		}
+	}()
+	router.HealthRouter.SetReady(true)
 
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	startCleanupJob(jobCtx)
+
+	// Reload model enumerations on config file change or SIGHUP, keeping the old config if the new one is invalid
+	onReload := func(err error) {
+		metrics.ObserveConfigReload(err)
+		if err != nil {
+			logger.Log.WithError(err).Error("Reload config fail, keep previous config")
+			return
+		}
+		logger.Log.Info("Config reloaded")
+	}
+	if err := config.Watch(jobCtx, onReload); err != nil {
+		logger.Log.WithError(err).Error("Watch config file fail, reload on SIGHUP only")
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			onReload(config.Reload())
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	logger.Log.WithField("signal", sig.String()).Info("Shutting down server")
+
+	// Report unready first and give the load balancer time to notice,
+	// so Pub/Sub pushes are routed elsewhere before we stop accepting them.
+	router.HealthRouter.SetReady(false)
+	stopJobs()
+	time.Sleep(time.Duration(config.Config.Server.ShutdownDelay) * time.Second)
+
+	// Shutdown waits for in-flight requests, such as pubsub pushes, to finish
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Config.Server.ShutdownTimeout)*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Log.WithError(err).Error("Server shutdown error")
+	}
+
+	// The shutdown ctx may have run out waiting for requests, so flush traces with a deadline of their own
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.Log.WithError(err).Error("Flush traces error")
+	}
+	if err := rrsql.Close(); err != nil {
+		logger.Log.WithError(err).Error("Close database error")
+	}
+	logger.Log.Info("Server exited")
 }
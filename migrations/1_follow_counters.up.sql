@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS follow_counters (
+    type TINYINT NOT NULL,
+    target_id BIGINT NOT NULL,
+    emotion TINYINT NOT NULL DEFAULT 0,
+    count INT NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (type, target_id, emotion)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO follow_counters (type, target_id, emotion, count)
+SELECT type, target_id, emotion, COUNT(*) FROM following GROUP BY type, target_id, emotion;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS following_archive;
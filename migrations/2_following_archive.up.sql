@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS following_archive (
+    member_id BIGINT NOT NULL,
+    target_id BIGINT NOT NULL,
+    type TINYINT NOT NULL,
+    emotion TINYINT NOT NULL DEFAULT 0,
+    created_at DATETIME NULL,
+    reason VARCHAR(32) NOT NULL,
+    archived_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_member (member_id),
+    KEY idx_target (type, target_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS erasure_receipts (
+    receipt_id CHAR(32) NOT NULL,
+    follows INT NOT NULL DEFAULT 0,
+    reactions INT NOT NULL DEFAULT 0,
+    anonymized INT NOT NULL DEFAULT 0,
+    erased_at DATETIME NOT NULL,
+    PRIMARY KEY (receipt_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+ALTER TABLE following_archive DROP COLUMN visibility;
+ALTER TABLE following DROP COLUMN visibility;
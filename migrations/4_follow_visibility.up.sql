@@ -0,0 +1,2 @@
+ALTER TABLE following ADD COLUMN visibility TINYINT NOT NULL DEFAULT 0;
+ALTER TABLE following_archive ADD COLUMN visibility TINYINT NOT NULL DEFAULT 0;
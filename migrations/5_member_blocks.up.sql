@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS member_blocks (
+    member_id BIGINT NOT NULL,
+    blocked_id BIGINT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (member_id, blocked_id),
+    KEY idx_blocked (blocked_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
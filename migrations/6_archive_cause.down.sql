@@ -0,0 +1,2 @@
+ALTER TABLE following_archive DROP KEY idx_cause;
+ALTER TABLE following_archive DROP COLUMN cause_id;
@@ -0,0 +1,2 @@
+ALTER TABLE following_archive ADD COLUMN cause_id BIGINT NULL AFTER reason;
+ALTER TABLE following_archive ADD KEY idx_cause (reason, cause_id);
@@ -0,0 +1 @@
+ALTER TABLE erasure_receipts DROP COLUMN blocks;
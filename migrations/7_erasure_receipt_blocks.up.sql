@@ -0,0 +1 @@
+ALTER TABLE erasure_receipts ADD COLUMN blocks INT NOT NULL DEFAULT 0 AFTER anonymized;
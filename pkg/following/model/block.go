@@ -0,0 +1,121 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+)
+
+// BlockArgs is Member blocking or unblocking Blocked
+type BlockArgs struct {
+	Member  int64
+	Blocked int64
+	// Action is block or unblock
+	Action string
+}
+
+// UpdateBlock records or lifts a block. Blocking also removes the member follows
+// between the two members in both directions, and returns how many were removed.
+func (f *followingAPI) UpdateBlock(ctx context.Context, params BlockArgs) (removed int, err error) {
+	if params.Member == params.Blocked {
+		return 0, errors.New("Cannot Block Self")
+	}
+	switch params.Action {
+	case "block":
+	case "unblock":
+		result, err := rrsql.DB.ExecContext(ctx, `DELETE FROM member_blocks WHERE member_id = ? AND blocked_id = ?;`, params.Member, params.Blocked)
+		if err != nil {
+			return 0, err
+		}
+		changed, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if changed == 0 {
+			return 0, rrsql.SQLUpdateFail
+		}
+		return 0, nil
+	default:
+		return 0, errors.New("Unsupported Block Action")
+	}
+
+	member, err := registry.Get("member")
+	if err != nil {
+		return 0, err
+	}
+	cond := "type = ? AND ((member_id = ? AND target_id = ?) OR (member_id = ? AND target_id = ?))"
+	args := []interface{}{member.FollowType, params.Member, params.Blocked, params.Blocked, params.Member}
+
+	err = rrsql.DB.Transact(ctx, func(tx *rrsql.Tx) error {
+		// Blocking again is a no-op besides clearing follows made in between
+		if _, err := tx.ExecContext(ctx, `INSERT IGNORE INTO member_blocks (member_id, blocked_id) VALUES (?, ?);`, params.Member, params.Blocked); err != nil {
+			return err
+		}
+		var keys []followKey
+		if err := tx.SelectContext(ctx, &keys, `SELECT DISTINCT 0 AS member_id, target_id, type, emotion FROM following WHERE `+cond+`;`, args...); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `DELETE FROM following WHERE `+cond+`;`, args...)
+		if err != nil {
+			return err
+		}
+		changed, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		removed = int(changed)
+		for _, k := range keys {
+			if err := recountCounter(ctx, tx, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// checkBlocked returns rrsql.BlockedError if the member followed in params has blocked the follower
+func checkBlocked(ctx context.Context, tx *rrsql.Tx, params FollowArgs) error {
+	member, err := registry.Get("member")
+	if err != nil || params.Type != member.FollowType {
+		return nil
+	}
+	var count int
+	if err = tx.GetContext(ctx, &count, `SELECT COUNT(*) FROM member_blocks WHERE member_id = ? AND blocked_id = ?;`, params.Object, params.Subject); err != nil {
+		return err
+	}
+	if count > 0 {
+		return rrsql.BlockedError
+	}
+	return nil
+}
+
+// notBlocked is the condition leaving out followers, in f, blocked by the followed member
+// or by the viewer. It is empty when neither applies.
+func (r *Resource) notBlocked() string {
+	var blockers []string
+	if member, err := registry.Get("member"); err == nil && r.FollowType == member.FollowType {
+		blockers = append(blockers, "f.target_id")
+	}
+	if r.Viewer != 0 {
+		blockers = append(blockers, fmt.Sprint(r.Viewer))
+	}
+	if len(blockers) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM member_blocks AS b WHERE b.blocked_id = f.member_id AND b.member_id IN (%s))", strings.Join(blockers, ", "))
+}
+
+// blockedPair is the condition that the member follow in alias is between members
+// where either has blocked the other
+func blockedPair(alias string, memberType int) string {
+	return fmt.Sprintf(`(%[1]s.type = %[2]d AND EXISTS (SELECT 1 FROM member_blocks AS b 
+	WHERE (b.member_id = %[1]s.target_id AND b.blocked_id = %[1]s.member_id) OR (b.member_id = %[1]s.member_id AND b.blocked_id = %[1]s.target_id)))`, alias, memberType)
+}
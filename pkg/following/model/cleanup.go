@@ -0,0 +1,180 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/readr-media/readr-restful-following/internal/logger"
+	"github.com/readr-media/readr-restful-following/internal/metrics"
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+	"github.com/sirupsen/logrus"
+)
+
+// CleanupArgs controls CleanupOrphans
+type CleanupArgs struct {
+	// DryRun only counts the orphans
+	DryRun bool
+	// Inactive also treats follows of deactivated targets and members as orphans
+	Inactive bool
+	// Archive copies the orphans to following_archive before deleting them
+	Archive   bool
+	BatchSize int
+}
+
+// OrphanReport is the number of orphaned follows of one resource found, or removed, for one reason
+type OrphanReport struct {
+	Resource string `json:"resource"`
+	Reason   string `json:"reason"`
+	Count    int    `json:"count"`
+}
+
+type orphanQuery struct {
+	resource  string
+	reason    string
+	join      string
+	condition string
+	args      []interface{}
+	// cause is the column of the deactivated member, whose follows are archived
+	// the way a deactivation does, so reactivating the member restores them
+	cause string
+}
+
+// orphanQueries lists the ways a follow can be orphaned: its target or its member
+// is missing from, or deactivated in, the registry table
+func orphanQueries(inactive bool) ([]orphanQuery, error) {
+	queries := make([]orphanQuery, 0)
+	for _, name := range registry.Names() {
+		res, err := registry.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		join := fmt.Sprintf("%s AS t ON f.target_id = t.%s", res.Table, res.PrimaryKey)
+		queries = append(queries, orphanQuery{resource: name, reason: "target_missing", join: join,
+			condition: fmt.Sprintf("f.type = ? AND t.%s IS NULL", res.PrimaryKey), args: []interface{}{res.FollowType}})
+		if v, ok := res.ActiveValue(); ok && inactive {
+			q := orphanQuery{resource: name, reason: "target_inactive", join: join,
+				condition: fmt.Sprintf("f.type = ? AND t.%s <> ?", res.ActiveColumn), args: []interface{}{res.FollowType, v}}
+			if name == "member" {
+				q.cause = "target_id"
+			}
+			queries = append(queries, q)
+		}
+	}
+
+	member, err := registry.Get("member")
+	if err != nil {
+		return nil, err
+	}
+	join := fmt.Sprintf("%s AS m ON f.member_id = m.%s", member.Table, member.PrimaryKey)
+	queries = append(queries, orphanQuery{resource: "all", reason: "member_missing", join: join,
+		condition: fmt.Sprintf("m.%s IS NULL", member.PrimaryKey)})
+	if v, ok := member.ActiveValue(); ok && inactive {
+		queries = append(queries, orphanQuery{resource: "all", reason: "member_inactive", join: join,
+			condition: fmt.Sprintf("m.%s <> ?", member.ActiveColumn), args: []interface{}{v}, cause: "member_id"})
+	}
+	return queries, nil
+}
+
+type followKey struct {
+	MemberID int64 `db:"member_id"`
+	TargetID int64 `db:"target_id"`
+	Type     int   `db:"type"`
+	Emotion  int   `db:"emotion"`
+}
+
+// removeOrphans archives, if asked, and deletes one batch of follows along with their counters.
+// Follows of deactivated members are archived as member_deactivated, caused by that member.
+func removeOrphans(ctx context.Context, keys []followKey, q orphanQuery, archive bool) (removed int, err error) {
+	reason, cause := q.reason, "NULL"
+	if q.cause != "" {
+		reason, cause = deactivatedReason, q.cause
+	}
+	err = rrsql.DB.Transact(ctx, func(tx *rrsql.Tx) error {
+		for _, k := range keys {
+			if archive {
+				_, err := tx.ExecContext(ctx, `INSERT INTO following_archive (member_id, target_id, type, emotion, visibility, created_at, reason, cause_id) 
+				SELECT member_id, target_id, type, emotion, visibility, created_at, ?, `+cause+` FROM following 
+				WHERE member_id = ? AND target_id = ? AND type = ? AND emotion = ?;`, reason, k.MemberID, k.TargetID, k.Type, k.Emotion)
+				if err != nil {
+					return err
+				}
+			}
+			result, err := tx.ExecContext(ctx, `DELETE FROM following WHERE member_id = ? AND target_id = ? AND type = ? AND emotion = ?;`, k.MemberID, k.TargetID, k.Type, k.Emotion)
+			if err != nil {
+				return err
+			}
+			changed, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if changed > 0 {
+				if err = adjustCounter(ctx, tx, k.Type, k.TargetID, k.Emotion, -int(changed)); err != nil {
+					return err
+				}
+			}
+			removed += int(changed)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// CleanupOrphans finds follows whose target or member no longer exists, or is deactivated with Inactive,
+// and removes them in batches of BatchSize. With DryRun it only reports how many there are.
+func CleanupOrphans(ctx context.Context, args CleanupArgs) ([]OrphanReport, error) {
+	queries, err := orphanQueries(args.Inactive)
+	if err != nil {
+		return nil, err
+	}
+	if args.BatchSize <= 0 {
+		args.BatchSize = 500
+	}
+	action := "delete"
+	if args.Archive {
+		action = "archive"
+	}
+
+	reports := make([]OrphanReport, 0)
+	for _, q := range queries {
+		report := OrphanReport{Resource: q.resource, Reason: q.reason}
+		log := logger.FromContext(ctx).WithFields(logrus.Fields{"resource": q.resource, "reason": q.reason})
+
+		if args.DryRun {
+			query := fmt.Sprintf("SELECT COUNT(*) FROM following AS f LEFT JOIN %s WHERE %s;", q.join, q.condition)
+			if err = rrsql.DB.GetContext(ctx, &report.Count, query, q.args...); err != nil {
+				return reports, err
+			}
+			reports = append(reports, report)
+			continue
+		}
+
+		// Removed rows drop out of the next batch, so always read from the start
+		query := fmt.Sprintf("SELECT f.member_id, f.target_id, f.type, f.emotion FROM following AS f LEFT JOIN %s WHERE %s LIMIT ?;", q.join, q.condition)
+		for {
+			var keys []followKey
+			if err = rrsql.DB.SelectContext(ctx, &keys, query, append(q.args, args.BatchSize)...); err != nil {
+				return reports, err
+			}
+			if len(keys) == 0 {
+				break
+			}
+			removed, err := removeOrphans(ctx, keys, q, args.Archive)
+			if err != nil {
+				log.WithError(err).Error("Remove orphaned follows error")
+				return reports, err
+			}
+			report.Count += removed
+			metrics.OrphanFollows.WithLabelValues(q.resource, q.reason, action).Add(float64(removed))
+			log.WithField("removed", removed).Info("Removed orphaned follows")
+			if len(keys) < args.BatchSize || removed == 0 {
+				break
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveOrphansArchive(t *testing.T) {
+	key := followKey{MemberID: 70, TargetID: 840, Type: 3, Emotion: 0}
+
+	for _, tc := range []struct {
+		name   string
+		query  orphanQuery
+		reason string
+		cause  string
+	}{
+		{"TargetMissing", orphanQuery{resource: "project", reason: "target_missing"}, "target_missing", "NULL"},
+		// Archived the way a deactivation does, so reactivating the member restores them
+		{"MemberInactive", orphanQuery{resource: "all", reason: "member_inactive", cause: "member_id"}, deactivatedReason, "member_id"},
+		{"MemberTargetInactive", orphanQuery{resource: "member", reason: "target_inactive", cause: "target_id"}, deactivatedReason, "target_id"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := mockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("SELECT member_id, target_id, type, emotion, visibility, created_at, ?, "+tc.cause+" FROM following")).
+				WithArgs(tc.reason, 70, 840, 3, 0).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(regexp.QuoteMeta("DELETE FROM following WHERE member_id = ? AND target_id = ? AND type = ? AND emotion = ?;")).
+				WithArgs(70, 840, 3, 0).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE follow_counters").WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			removed, err := removeOrphans(context.Background(), []followKey{key}, tc.query, true)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, removed)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"context"
+
+	"github.com/readr-media/readr-restful-following/internal/logger"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+	"github.com/sirupsen/logrus"
+)
+
+// follow_counters keeps COUNT(*) of following per (type, target_id, emotion).
+// It is changed in the same transaction as the following row, see followingAPI.Insert.
+// Deactivating or deleting a member through UpdateMember moves or removes their follows and
+// recounts the targets, but follows of a member removed from the members table some other way
+// stay counted until the cleanup command removes them as member_missing.
+
+// adjustCounter adds delta to the counter of one target and emotion, never going below zero
+func adjustCounter(ctx context.Context, tx *rrsql.Tx, followType int, targetID int64, emotion int, delta int) error {
+	if delta > 0 {
+		_, err := tx.ExecContext(ctx, `INSERT INTO follow_counters (type, target_id, emotion, count) VALUES (?, ?, ?, ?) 
+		ON DUPLICATE KEY UPDATE count = count + VALUES(count);`, followType, targetID, emotion, delta)
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `UPDATE follow_counters SET count = GREATEST(count + ?, 0) 
+	WHERE type = ? AND target_id = ? AND emotion = ?;`, delta, followType, targetID, emotion)
+	return err
+}
+
+// CounterDrift is a follow_counters row that disagrees with the following table
+type CounterDrift struct {
+	Type     int   `db:"type" json:"type"`
+	TargetID int64 `db:"target_id" json:"target_id"`
+	Emotion  int   `db:"emotion" json:"emotion"`
+	Stored   int   `db:"stored" json:"stored"`
+	Actual   int   `db:"actual" json:"actual"`
+}
+
+// ReconcileCounters recomputes follow_counters from following and returns the drifted rows.
+// The rows are only repaired when dryRun is false.
+func ReconcileCounters(ctx context.Context, dryRun bool) (drifts []CounterDrift, err error) {
+
+	query := `SELECT a.type, a.target_id, a.emotion, IFNULL(c.count, 0) AS stored, a.count AS actual 
+	FROM (SELECT type, target_id, emotion, COUNT(*) AS count FROM following GROUP BY type, target_id, emotion) AS a 
+	LEFT JOIN follow_counters AS c ON c.type = a.type AND c.target_id = a.target_id AND c.emotion = a.emotion 
+	WHERE c.count IS NULL OR c.count <> a.count 
+	UNION ALL 
+	SELECT c.type, c.target_id, c.emotion, c.count AS stored, 0 AS actual FROM follow_counters AS c 
+	LEFT JOIN (SELECT DISTINCT type, target_id, emotion FROM following) AS a ON c.type = a.type AND c.target_id = a.target_id AND c.emotion = a.emotion 
+	WHERE a.type IS NULL AND c.count <> 0;`
+
+	rows, err := rrsql.DB.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drifts = make([]CounterDrift, 0)
+	for rows.Next() {
+		var d CounterDrift
+		if err = rows.StructScan(&d); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return drifts, nil
+	}
+
+	// Count again while repairing, since follows may have changed after the drift query
+	for _, d := range drifts {
+		_, err = rrsql.DB.ExecContext(ctx, `INSERT INTO follow_counters (type, target_id, emotion, count) 
+		SELECT ?, ?, ?, COUNT(*) FROM following WHERE type = ? AND target_id = ? AND emotion = ? 
+		ON DUPLICATE KEY UPDATE count = VALUES(count);`, d.Type, d.TargetID, d.Emotion, d.Type, d.TargetID, d.Emotion)
+		if err != nil {
+			return drifts, err
+		}
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"type": d.Type, "target_id": d.TargetID, "emotion": d.Emotion, "stored": d.Stored, "actual": d.Actual,
+		}).Info("Repaired follow counter")
+	}
+	return drifts, nil
+}
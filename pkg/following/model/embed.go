@@ -0,0 +1,200 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+	"github.com/readr-media/readr-restful-following/internal/utils"
+)
+
+// EmbedArgs asks for related records to be returned along with follows, e.g. embed=members
+type EmbedArgs struct {
+	Embed        string `form:"embed" json:"embed"`
+	MemberFields string `form:"member_fields" json:"member_fields"`
+}
+
+// EmbedOptions lists what EmbedArgs.Embed accepts
+var EmbedOptions = []string{"members", "target", "url"}
+
+// MemberEmbedFields whitelists the member columns EmbedArgs.MemberFields may pick
+var MemberEmbedFields = map[string]string{
+	"nickname":      "nickname",
+	"profile_image": "profile_image",
+	"role":          "role",
+}
+
+type MemberProfile struct {
+	ID           int64            `db:"id" json:"id"`
+	Nickname     rrsql.NullString `db:"nickname" json:"nickname"`
+	ProfileImage rrsql.NullString `db:"profile_image" json:"profile_image"`
+	Role         rrsql.NullInt    `db:"role" json:"role"`
+}
+
+// TargetInfo holds the registry.TargetFields of a followed target which its table has
+type TargetInfo struct {
+	ID        int64   `db:"id" json:"id"`
+	Title     *string `db:"title" json:"title,omitempty"`
+	Slug      *string `db:"slug" json:"slug,omitempty"`
+	Name      *string `db:"name" json:"name,omitempty"`
+	HeroImage *string `db:"hero_image" json:"hero_image,omitempty"`
+}
+
+func splitList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (e EmbedArgs) embeds(name string) bool {
+	for _, item := range splitList(e.Embed) {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// memberColumns returns the columns picked by MemberFields, or all whitelisted ones
+func (e EmbedArgs) memberColumns() ([]string, error) {
+	fields := splitList(e.MemberFields)
+	if len(fields) == 0 {
+		fields = []string{"nickname", "profile_image", "role"}
+	}
+	columns := make([]string, 0)
+	for _, field := range fields {
+		column, ok := MemberEmbedFields[field]
+		if !ok {
+			return nil, fmt.Errorf("Invalid Member Field %s", field)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// Validate checks Embed and MemberFields against EmbedOptions and MemberEmbedFields
+func (e EmbedArgs) Validate() error {
+	for _, item := range splitList(e.Embed) {
+		valid := false
+		for _, option := range EmbedOptions {
+			if item == option {
+				valid = true
+			}
+		}
+		if !valid {
+			return fmt.Errorf("Invalid Embed %s", item)
+		}
+	}
+	_, err := e.memberColumns()
+	return err
+}
+
+// hydrateMembers loads the whitelisted profile columns of members ids
+func (e EmbedArgs) hydrateMembers(ctx context.Context, ids []int64) (map[int64]MemberProfile, error) {
+	profiles := make(map[int64]MemberProfile)
+	if len(ids) == 0 {
+		return profiles, nil
+	}
+	columns, err := e.memberColumns()
+	if err != nil {
+		return nil, err
+	}
+	res, err := registry.Get("member")
+	if err != nil {
+		return nil, err
+	}
+	query, args, err := sqlx.In(fmt.Sprintf("SELECT %s AS id, %s FROM %s WHERE %s IN (?);", res.PrimaryKey, strings.Join(columns, ", "), res.Table, res.PrimaryKey), ids)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := rrsql.DB.QueryxContext(ctx, rrsql.DB.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p MemberProfile
+		if err = rows.StructScan(&p); err != nil {
+			return nil, err
+		}
+		profiles[p.ID] = p
+	}
+	return profiles, rows.Err()
+}
+
+// hydrateTargets loads the TargetInfo of res targets ids, in one query per resource
+func hydrateTargets(ctx context.Context, res registry.Resource, ids []int64) (map[int64]TargetInfo, error) {
+	targets := make(map[int64]TargetInfo)
+	if len(ids) == 0 || len(res.TargetColumns) == 0 {
+		return targets, nil
+	}
+	columns := []string{fmt.Sprintf("%s AS id", res.PrimaryKey)}
+	for _, field := range registry.TargetFields {
+		if column, ok := res.TargetColumns[field]; ok {
+			columns = append(columns, fmt.Sprintf("%s AS %s", column, field))
+		}
+	}
+	query, args, err := sqlx.In(fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (?);", strings.Join(columns, ", "), res.Table, res.PrimaryKey), ids)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := rrsql.DB.QueryxContext(ctx, rrsql.DB.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t TargetInfo
+		if err = rows.StructScan(&t); err != nil {
+			return nil, err
+		}
+		targets[t.ID] = t
+	}
+	return targets, rows.Err()
+}
+
+// resourceURLs builds the canonical URLs of res targets ids with utils.GenerateResourceInfo,
+// reading the slugs through res.URLSlug. Resources without a readr page, and targets
+// of slug resources without a slug, get none.
+func resourceURLs(ctx context.Context, res registry.Resource, ids []int64) (map[int64]string, error) {
+	urls := make(map[int64]string)
+	if len(ids) == 0 || utils.GenerateResourceInfo(res.Name, 0, "") == "" {
+		return urls, nil
+	}
+	if res.URLSlug == "" {
+		for _, id := range ids {
+			urls[id] = utils.GenerateResourceInfo(res.Name, int(id), "")
+		}
+		return urls, nil
+	}
+	query, args, err := sqlx.In(fmt.Sprintf("SELECT %s AS id, IFNULL(%s, '') AS slug FROM %s WHERE %s IN (?);", res.PrimaryKey, res.URLSlug, res.Table, res.PrimaryKey), ids)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := rrsql.DB.QueryxContext(ctx, rrsql.DB.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id   int64
+			slug string
+		)
+		if err = rows.Scan(&id, &slug); err != nil {
+			return nil, err
+		}
+		if slug == "" {
+			continue
+		}
+		urls[id] = utils.GenerateResourceInfo(res.Name, int(id), slug)
+	}
+	return urls, rows.Err()
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFollowedFollowerLimit(t *testing.T) {
+
+	for _, tc := range []struct {
+		name  string
+		limit int
+		want  string
+	}{
+		// Without follower_limit the list is still capped, so group_concat_max_len never cuts an ID
+		{"Default", 0, "ORDER BY f.created_at DESC SEPARATOR ','), ',', 100)"},
+		{"Limit", 10, "ORDER BY f.created_at DESC SEPARATOR ','), ',', 10)"},
+		{"AboveMax", 500, "ORDER BY f.created_at DESC SEPARATOR ','), ',', 100)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := mockDB(t)
+			mock.ExpectQuery(regexp.QuoteMeta(tc.want)).
+				WillReturnRows(sqlmock.NewRows([]string{"target_id", "count", "follower"}))
+
+			args := &GetFollowedArgs{IDs: []int64{840}, FollowerLimit: tc.limit, Resource: Resource{ResourceName: "project", FollowType: 3}}
+			rows, err := args.get(context.Background())
+			if assert.NoError(t, err) {
+				rows.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+)
+
+// MemberArgs is a change of a member's state, which cascades to the follows of and by the member
+type MemberArgs struct {
+	ID int64
+	// Action is deactivate, reactivate or delete
+	Action string
+}
+
+// deactivatedReason marks the following_archive rows hidden by a deactivation,
+// whose cause_id is the deactivated member
+const deactivatedReason = "member_deactivated"
+
+// recountCounter sets one follow_counters row to the number of following rows it counts
+func recountCounter(ctx context.Context, tx *rrsql.Tx, k followKey) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO follow_counters (type, target_id, emotion, count) 
+	SELECT ?, ?, ?, COUNT(*) FROM following WHERE type = ? AND target_id = ? AND emotion = ? 
+	ON DUPLICATE KEY UPDATE count = VALUES(count);`, k.Type, k.TargetID, k.Emotion, k.Type, k.TargetID, k.Emotion)
+	return err
+}
+
+// UpdateMember hides the follows of and by a deactivated member in following_archive,
+// restores them on reactivation and purges them from both tables on deletion.
+// Reactivation only restores the rows its own deactivation archived; a follow with another
+// member still deactivated stays archived, and is handed over to that member's deactivation.
+// It returns how many follows were moved or removed.
+func (f *followingAPI) UpdateMember(ctx context.Context, params MemberArgs) (affected int, err error) {
+	member, err := registry.Get("member")
+	if err != nil {
+		return 0, err
+	}
+	// Follows in both directions: by the member, and of the member as a target
+	cond := "(member_id = ? OR (type = ? AND target_id = ?))"
+	args := []interface{}{params.ID, member.FollowType, params.ID}
+
+	var keysQuery string
+	switch params.Action {
+	case "deactivate", "delete":
+		keysQuery = `SELECT DISTINCT 0 AS member_id, target_id, type, emotion FROM following WHERE ` + cond + `;`
+	case "reactivate":
+		// Only the rows archived for this member
+		cond = "cause_id = ?"
+		args = []interface{}{deactivatedReason, params.ID}
+		keysQuery = `SELECT DISTINCT 0 AS member_id, target_id, type, emotion FROM following_archive WHERE reason = ? AND ` + cond + `;`
+	default:
+		return 0, errors.New("Unsupported Member Action")
+	}
+
+	err = rrsql.DB.Transact(ctx, func(tx *rrsql.Tx) error {
+		// Counters of these keys are recounted once the rows moved
+		if params.Action == "reactivate" {
+			if err := handOverInactive(ctx, tx, member, params.ID); err != nil {
+				return err
+			}
+		}
+		var keys []followKey
+		if err := tx.SelectContext(ctx, &keys, keysQuery, args...); err != nil {
+			return err
+		}
+
+		var statements []string
+		switch params.Action {
+		case "deactivate":
+			statements = []string{
+				`INSERT INTO following_archive (member_id, target_id, type, emotion, visibility, created_at, reason, cause_id) 
+				SELECT member_id, target_id, type, emotion, visibility, created_at, '` + deactivatedReason + `', ` + strconv.FormatInt(params.ID, 10) + ` FROM following WHERE ` + cond + `;`,
+				`DELETE FROM following WHERE ` + cond + `;`,
+			}
+		case "reactivate":
+			// Follows made again in the meantime win over the archived ones,
+			// and follows between members who blocked each other meanwhile are dropped
+			statements = []string{
+				`INSERT IGNORE INTO following (member_id, target_id, type, emotion, visibility, created_at) 
+				SELECT member_id, target_id, type, emotion, visibility, created_at FROM following_archive AS a WHERE reason = ? AND ` + cond + ` 
+				AND NOT ` + blockedPair("a", member.FollowType) + `;`,
+				`DELETE FROM following_archive WHERE reason = ? AND ` + cond + `;`,
+			}
+		case "delete":
+			statements = []string{
+				`DELETE FROM following WHERE ` + cond + `;`,
+				`DELETE FROM following_archive WHERE ` + cond + `;`,
+			}
+		}
+		for i, statement := range statements {
+			result, err := tx.ExecContext(ctx, statement, args...)
+			if err != nil {
+				return err
+			}
+			// The first statement moves or removes the follows
+			if i == 0 {
+				changed, err := result.RowsAffected()
+				if err != nil {
+					return err
+				}
+				affected = int(changed)
+			}
+		}
+		// A deleted member blocks no one, and is blocked by no one
+		if params.Action == "delete" {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM member_blocks WHERE member_id = ? OR blocked_id = ?;`, params.ID, params.ID); err != nil {
+				return err
+			}
+		}
+		for _, k := range keys {
+			if err := recountCounter(ctx, tx, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// handOverInactive re-attributes the follows archived for id whose other member is still
+// deactivated to that member, so they stay archived until it is reactivated too
+func handOverInactive(ctx context.Context, tx *rrsql.Tx, member registry.Resource, id int64) error {
+	active, ok := member.ActiveValue()
+	if !ok {
+		return nil
+	}
+	inactive := fmt.Sprintf("SELECT %s FROM %s WHERE %s != ?", member.PrimaryKey, member.Table, member.ActiveColumn)
+	_, err := tx.ExecContext(ctx, `UPDATE following_archive SET cause_id = IF(member_id = ?, target_id, member_id) 
+	WHERE reason = ? AND cause_id = ? AND type = ? 
+	AND ((member_id = ? AND target_id IN (`+inactive+`)) OR (target_id = ? AND member_id IN (`+inactive+`)));`,
+		id, deactivatedReason, id, member.FollowType, id, active, id, active)
+	return err
+}
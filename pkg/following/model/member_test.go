@@ -0,0 +1,75 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateMemberReactivate(t *testing.T) {
+	member, err := registry.Get("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, _ := member.ActiveValue()
+
+	mock := mockDB(t)
+	mock.ExpectBegin()
+	// Follows with another member still deactivated are handed over to that member first
+	mock.ExpectExec(`UPDATE following_archive SET cause_id = IF\(member_id = \?, target_id, member_id\)`).
+		WithArgs(70, deactivatedReason, 70, member.FollowType, 70, active, 70, active).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT DISTINCT 0 AS member_id, target_id, type, emotion FROM following_archive WHERE reason = \? AND cause_id = \?;`).
+		WithArgs(deactivatedReason, 70).
+		WillReturnRows(sqlmock.NewRows([]string{"member_id", "target_id", "type", "emotion"}).AddRow(0, 72, member.FollowType, 0))
+	// Only rows archived by this member's own deactivation come back, unless either member blocked the other
+	mock.ExpectExec(`INSERT IGNORE INTO following .* FROM following_archive AS a WHERE reason = \? AND cause_id = \?\s+AND NOT \(a.type = \d+ AND EXISTS \(SELECT 1 FROM member_blocks AS b`).
+		WithArgs(deactivatedReason, 70).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM following_archive WHERE reason = \? AND cause_id = \?;`).
+		WithArgs(deactivatedReason, 70).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO follow_counters`).
+		WithArgs(member.FollowType, 72, 0, member.FollowType, 72, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	affected, err := new(followingAPI).UpdateMember(context.Background(), MemberArgs{ID: 70, Action: "reactivate"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, affected)
+}
+
+func TestUpdateMemberDeactivate(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT DISTINCT 0 AS member_id, target_id, type, emotion FROM following WHERE`).
+		WillReturnRows(sqlmock.NewRows([]string{"member_id", "target_id", "type", "emotion"}))
+	// Archived rows record the deactivated member as their cause
+	mock.ExpectExec(`INSERT INTO following_archive \(.*, reason, cause_id\)\s+SELECT .*, 'member_deactivated', 70 FROM following WHERE`).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`DELETE FROM following WHERE`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	affected, err := new(followingAPI).UpdateMember(context.Background(), MemberArgs{ID: 70, Action: "deactivate"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, affected)
+}
+
+func TestUpdateMemberDelete(t *testing.T) {
+	mock := mockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT DISTINCT 0 AS member_id, target_id, type, emotion FROM following WHERE`).
+		WillReturnRows(sqlmock.NewRows([]string{"member_id", "target_id", "type", "emotion"}))
+	mock.ExpectExec(`DELETE FROM following WHERE`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`DELETE FROM following_archive WHERE`).WillReturnResult(sqlmock.NewResult(0, 1))
+	// Blocks of and by the deleted member go too
+	mock.ExpectExec(`DELETE FROM member_blocks WHERE member_id = \? OR blocked_id = \?;`).WithArgs(70, 70).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	affected, err := new(followingAPI).UpdateMember(context.Background(), MemberArgs{ID: 70, Action: "delete"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, affected)
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+)
+
+// MergeArgs merges the follows of Source into Target, e.g. after combining duplicate accounts.
+// With DryRun the merge is rolled back, only reporting what it would change.
+type MergeArgs struct {
+	Source int64 `json:"source"`
+	Target int64 `json:"target"`
+	DryRun bool  `json:"dry_run"`
+}
+
+// errMergeDryRun rolls back a dry run merge
+var errMergeDryRun = errors.New("Merge Dry Run")
+
+// MergeReport counts the rows each step of a merge changed
+type MergeReport struct {
+	Source int64 `json:"source"`
+	Target int64 `json:"target"`
+	// Moved follows of Source now belong to Target; Duplicates were dropped since Target had them already.
+	// A reaction counts as a duplicate of any reaction of Target to the same target.
+	Moved      int `json:"moved"`
+	Duplicates int `json:"duplicates"`
+	// Rewritten follows of Source now follow Target; RewriteDuplicates were dropped likewise
+	Rewritten         int `json:"rewritten"`
+	RewriteDuplicates int `json:"rewrite_duplicates"`
+	// SelfFollows were between Source and Target, so Target would follow itself, live or archived
+	SelfFollows int `json:"self_follows"`
+	// Blocks of and by Source now belong to Target. Blocked follows were moved or rewritten
+	// between Target and a member either has blocked.
+	Blocks  int `json:"blocks"`
+	Blocked int `json:"blocked"`
+	// Archived following_archive rows by or of Source now refer to Target;
+	// ArchiveDuplicates were dropped since Target had the same row archived already
+	Archived          int  `json:"archived"`
+	ArchiveDuplicates int  `json:"archive_duplicates"`
+	DryRun            bool `json:"dry_run,omitempty"`
+}
+
+func (f *followingAPI) MergeMember(ctx context.Context, params MergeArgs) (report MergeReport, err error) {
+	if params.Source <= 0 || params.Target <= 0 || params.Source == params.Target {
+		return report, errors.New("Bad Member ID")
+	}
+	member, err := registry.Get("member")
+	if err != nil {
+		return report, err
+	}
+	source, target, memberType := params.Source, params.Target, member.FollowType
+	report = MergeReport{Source: source, Target: target, DryRun: params.DryRun}
+
+	steps := []struct {
+		query string
+		args  []interface{}
+		count *int
+	}{
+		// Blocks between Source and Target themselves are dropped
+		{`INSERT IGNORE INTO member_blocks (member_id, blocked_id, created_at) 
+		SELECT ?, blocked_id, created_at FROM member_blocks WHERE member_id = ? AND blocked_id <> ?;`, []interface{}{target, source, target}, &report.Blocks},
+		{`INSERT IGNORE INTO member_blocks (member_id, blocked_id, created_at) 
+		SELECT member_id, ?, created_at FROM member_blocks WHERE blocked_id = ? AND member_id <> ?;`, []interface{}{target, source, target}, &report.Blocks},
+		{`DELETE FROM member_blocks WHERE member_id = ? OR blocked_id = ?;`, []interface{}{source, source}, nil},
+		{`DELETE s FROM following AS s JOIN following AS t ON t.member_id = ? AND t.target_id = s.target_id AND t.type = s.type 
+		AND (t.emotion = s.emotion OR (t.emotion <> 0 AND s.emotion <> 0)) WHERE s.member_id = ?;`, []interface{}{target, source}, &report.Duplicates},
+		{`UPDATE following SET member_id = ? WHERE member_id = ?;`, []interface{}{target, source}, &report.Moved},
+		{`DELETE s FROM following AS s JOIN following AS t ON t.type = s.type AND t.target_id = ? AND t.member_id = s.member_id 
+		AND t.emotion = s.emotion WHERE s.type = ? AND s.target_id = ?;`, []interface{}{target, memberType, source}, &report.RewriteDuplicates},
+		{`UPDATE following SET target_id = ? WHERE type = ? AND target_id = ?;`, []interface{}{target, memberType, source}, &report.Rewritten},
+		{`DELETE FROM following WHERE type = ? AND member_id = ? AND target_id = ?;`, []interface{}{memberType, target, target}, &report.SelfFollows},
+		{`DELETE f FROM following AS f WHERE (f.member_id = ? OR f.target_id = ?) AND ` + blockedPair("f", memberType) + `;`, []interface{}{target, target}, &report.Blocked},
+		// following_archive has no unique key, so its duplicates are dropped explicitly the same way
+		{`DELETE s FROM following_archive AS s JOIN following_archive AS t ON t.member_id = ? AND t.target_id = s.target_id AND t.type = s.type 
+		AND t.emotion = s.emotion WHERE s.member_id = ?;`, []interface{}{target, source}, &report.ArchiveDuplicates},
+		{`UPDATE following_archive SET member_id = ? WHERE member_id = ?;`, []interface{}{target, source}, &report.Archived},
+		{`DELETE s FROM following_archive AS s JOIN following_archive AS t ON t.type = s.type AND t.target_id = ? AND t.member_id = s.member_id 
+		AND t.emotion = s.emotion WHERE s.type = ? AND s.target_id = ?;`, []interface{}{target, memberType, source}, &report.ArchiveDuplicates},
+		{`UPDATE following_archive SET target_id = ? WHERE type = ? AND target_id = ?;`, []interface{}{target, memberType, source}, &report.Archived},
+		{`DELETE FROM following_archive WHERE type = ? AND member_id = ? AND target_id = ?;`, []interface{}{memberType, target, target}, &report.SelfFollows},
+		// Rows hidden by the deactivation of Source now come back with Target's reactivation
+		{`UPDATE following_archive SET cause_id = ? WHERE reason = ? AND cause_id = ?;`, []interface{}{target, deactivatedReason, source}, nil},
+	}
+
+	err = rrsql.DB.Transact(ctx, func(tx *rrsql.Tx) error {
+		// Counters of what Source followed, of the members Target followed, whom blocks taken over
+		// may unfollow, and of both members as targets, are recounted afterwards
+		var keys []followKey
+		if err := tx.SelectContext(ctx, &keys, `SELECT DISTINCT 0 AS member_id, target_id, type, emotion FROM following 
+		WHERE member_id = ? OR (type = ? AND (member_id = ? OR target_id IN (?, ?)));`, source, memberType, target, source, target); err != nil {
+			return err
+		}
+		for _, step := range steps {
+			result, err := tx.ExecContext(ctx, step.query, step.args...)
+			if err != nil {
+				return err
+			}
+			if step.count == nil {
+				continue
+			}
+			changed, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			*step.count += int(changed)
+		}
+		for _, k := range keys {
+			if err := recountCounter(ctx, tx, k); err != nil {
+				return err
+			}
+		}
+		if params.DryRun {
+			return errMergeDryRun
+		}
+		return nil
+	})
+	if err == errMergeDryRun {
+		return report, nil
+	}
+	if err != nil {
+		return MergeReport{}, err
+	}
+	return report, nil
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectMerge expects the merge of member 71 into 70 step by step, each changing rows as given
+func expectMerge(t *testing.T, mock sqlmock.Sqlmock, rows ...int64) {
+	member, err := registry.Get("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	memberType := member.FollowType
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT DISTINCT 0 AS member_id, target_id, type, emotion FROM following\s+WHERE member_id = \? OR \(type = \? AND \(member_id = \? OR target_id IN \(\?, \?\)\)\);`).
+		WithArgs(71, memberType, 70, 71, 70).
+		WillReturnRows(sqlmock.NewRows([]string{"member_id", "target_id", "type", "emotion"}).AddRow(0, 84, 2, 0))
+	for i, step := range []struct {
+		query string
+		args  []interface{}
+	}{
+		// 70 takes over the blocks of and by 71, except the ones between the two
+		{`INSERT IGNORE INTO member_blocks \(member_id, blocked_id, created_at\)\s+SELECT \?, blocked_id, created_at FROM member_blocks WHERE member_id = \? AND blocked_id <> \?;`, []interface{}{70, 71, 70}},
+		{`INSERT IGNORE INTO member_blocks \(member_id, blocked_id, created_at\)\s+SELECT member_id, \?, created_at FROM member_blocks WHERE blocked_id = \? AND member_id <> \?;`, []interface{}{70, 71, 70}},
+		{`DELETE FROM member_blocks WHERE member_id = \? OR blocked_id = \?;`, []interface{}{71, 71}},
+		// Follows of 71 that 70 has already, where any two reactions to one target are duplicates
+		{`DELETE s FROM following AS s JOIN following AS t ON t.member_id = \? AND t.target_id = s.target_id AND t.type = s.type\s+AND \(t.emotion = s.emotion OR \(t.emotion <> 0 AND s.emotion <> 0\)\) WHERE s.member_id = \?;`, []interface{}{70, 71}},
+		{`UPDATE following SET member_id = \? WHERE member_id = \?;`, []interface{}{70, 71}},
+		// Followers of 71 who follow 70 already
+		{`DELETE s FROM following AS s JOIN following AS t ON t.type = s.type AND t.target_id = \? AND t.member_id = s.member_id\s+AND t.emotion = s.emotion WHERE s.type = \? AND s.target_id = \?;`, []interface{}{70, memberType, 71}},
+		{`UPDATE following SET target_id = \? WHERE type = \? AND target_id = \?;`, []interface{}{70, memberType, 71}},
+		{`DELETE FROM following WHERE type = \? AND member_id = \? AND target_id = \?;`, []interface{}{memberType, 70, 70}},
+		// Nor may 70 end up following, or followed by, a member either has blocked
+		{`DELETE f FROM following AS f WHERE \(f.member_id = \? OR f.target_id = \?\) AND \(f.type = \d+ AND EXISTS \(SELECT 1 FROM member_blocks AS b`, []interface{}{70, 70}},
+		{`DELETE s FROM following_archive AS s JOIN following_archive AS t ON t.member_id = \? AND t.target_id = s.target_id AND t.type = s.type\s+AND t.emotion = s.emotion WHERE s.member_id = \?;`, []interface{}{70, 71}},
+		{`UPDATE following_archive SET member_id = \? WHERE member_id = \?;`, []interface{}{70, 71}},
+		// Archived follows of 71 are rewritten as well, so reactivation never restores follows of 71
+		{`DELETE s FROM following_archive AS s JOIN following_archive AS t ON t.type = s.type AND t.target_id = \? AND t.member_id = s.member_id\s+AND t.emotion = s.emotion WHERE s.type = \? AND s.target_id = \?;`, []interface{}{70, memberType, 71}},
+		{`UPDATE following_archive SET target_id = \? WHERE type = \? AND target_id = \?;`, []interface{}{70, memberType, 71}},
+		{`DELETE FROM following_archive WHERE type = \? AND member_id = \? AND target_id = \?;`, []interface{}{memberType, 70, 70}},
+		{`UPDATE following_archive SET cause_id = \? WHERE reason = \? AND cause_id = \?;`, []interface{}{70, deactivatedReason, 71}},
+	} {
+		var changed int64
+		if i < len(rows) {
+			changed = rows[i]
+		}
+		args := make([]driver.Value, len(step.args))
+		for j, arg := range step.args {
+			args[j] = arg
+		}
+		mock.ExpectExec(step.query).WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, changed))
+	}
+	mock.ExpectExec(`INSERT INTO follow_counters`).WithArgs(2, 84, 0, 2, 84, 0).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestMergeMember(t *testing.T) {
+
+	t.Run("Commit", func(t *testing.T) {
+		mock := mockDB(t)
+		expectMerge(t, mock, 2, 1, 3, 1, 4, 2, 3, 1, 2, 1, 5, 2, 6, 1, 2)
+		mock.ExpectCommit()
+
+		report, err := new(followingAPI).MergeMember(context.Background(), MergeArgs{Source: 71, Target: 70})
+		assert.NoError(t, err)
+		assert.Equal(t, MergeReport{
+			Source: 71, Target: 70,
+			Duplicates: 1, Moved: 4,
+			RewriteDuplicates: 2, Rewritten: 3,
+			SelfFollows: 2, Blocks: 3, Blocked: 2,
+			ArchiveDuplicates: 3, Archived: 11,
+		}, report)
+	})
+	t.Run("DryRunRollsBack", func(t *testing.T) {
+		mock := mockDB(t)
+		expectMerge(t, mock, 0, 0, 0, 0, 4)
+		mock.ExpectRollback()
+
+		report, err := new(followingAPI).MergeMember(context.Background(), MergeArgs{Source: 71, Target: 70, DryRun: true})
+		assert.NoError(t, err)
+		assert.Equal(t, MergeReport{Source: 71, Target: 70, Moved: 4, DryRun: true}, report)
+	})
+	t.Run("SameMember", func(t *testing.T) {
+		_, err := new(followingAPI).MergeMember(context.Background(), MergeArgs{Source: 70, Target: 70})
+		assert.EqualError(t, err, "Bad Member ID")
+	})
+}
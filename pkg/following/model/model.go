@@ -1,9 +1,10 @@
 package model
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -11,18 +12,36 @@ import (
 	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/logger"
+	"github.com/readr-media/readr-restful-following/internal/metrics"
+	"github.com/readr-media/readr-restful-following/internal/registry"
 	"github.com/readr-media/readr-restful-following/internal/rrsql"
+	"github.com/readr-media/readr-restful-following/internal/tracing"
+	"github.com/sirupsen/logrus"
 )
 
 type Resource struct {
 	ResourceName string `form:"resource" json:"resource"`
-	ResourceType string `form:"resource_type" json:"resource_type, omitempty"`
+	ResourceType string `form:"resource_type" json:"resource_type,omitempty"`
 	Table        string
 	PrimaryKey   string
 	FollowType   int
 	Emotion      int
 	MaxResult    int `form:"max_result"`
 	Page         int `form:"page"`
+	// Viewer is the member asking, who also sees their own private follows.
+	// It only comes from the gateway through SetViewer, never from request parameters.
+	Viewer int64 `form:"-" json:"-"`
+}
+
+// SetViewer sets the member asking, as authenticated by the gateway
+func (r *Resource) SetViewer(id int64) {
+	r.Viewer = id
+}
+
+// visibility returns the models.follow_visibility value of name, e.g. "private"
+func visibility(name string) int {
+	return config.Current().Models.FollowVisibility[name]
 }
 
 type FollowingSQL struct {
@@ -54,12 +73,60 @@ func (f *FollowingSQL) SQL() string {
 	return fmt.Sprintf(f.base, f.printargs...)
 }
 
+// OrderBy validates a sort parameter such as "-count,target_id" against fields
+// and converts it to an ORDER BY expression with rrsql.OrderByHelper
+func OrderBy(sort string, fields map[string]string) (string, error) {
+	columns := strings.Split(sort, ",")
+	for i, field := range columns {
+		field = strings.TrimSpace(field)
+		desc := strings.HasPrefix(field, "-")
+		column, ok := fields[strings.TrimPrefix(field, "-")]
+		if !ok {
+			return "", fmt.Errorf("Invalid Sort Field %s", field)
+		}
+		if desc {
+			column = "-" + column
+		}
+		columns[i] = column
+	}
+	return rrsql.OrderByHelper(strings.Join(columns, ",")), nil
+}
+
+// appendFilter adds the conditions of filter, restricted to the whitelisted fields
+func (f *FollowingSQL) appendFilter(filter rrsql.Filter, fields map[string]string) error {
+	conditions, args, err := filter.Conditions(fields)
+	if err != nil {
+		return err
+	}
+	f.condition = append(f.condition, conditions...)
+	f.args = append(f.args, args...)
+	return nil
+}
+
+// appendAvailable keeps only rows of alias that are active and published,
+// as far as the registry defines those columns for res
+func (f *FollowingSQL) appendAvailable(alias string, res registry.Resource) {
+	if v, ok := res.ActiveValue(); ok {
+		f.AppendCondition(fmt.Sprintf("%s.%s = ?", alias, res.ActiveColumn))
+		f.AppendArg(v)
+	}
+	if v, ok := res.PublishValue(); ok {
+		f.AppendCondition(fmt.Sprintf("%s.%s = ?", alias, res.PublishColumn))
+		f.AppendArg(v)
+	}
+}
+
 type FollowArgs struct {
-	Resource string
-	Subject  int64
-	Object   int64
-	Type     int
-	Emotion  int
+	Resource   string
+	Subject    int64
+	Object     int64
+	Type       int
+	Emotion    int
+	Visibility int
+}
+
+func (f FollowArgs) logFields() logrus.Fields {
+	return logrus.Fields{"resource": f.Resource, "subject": f.Subject, "object": f.Object, "emotion": f.Emotion}
 }
 
 /* ================================================ Get Following ================================================ */
@@ -68,11 +135,14 @@ type FollowingItem struct {
 	Type       int            `db:"type" json:"type"`
 	TargetID   int            `db:"target_id" json:"target_id"`
 	FollowedAt rrsql.NullTime `db:"created_at" json:"followed_at"`
+	Member     *MemberProfile `json:"member,omitempty"`
+	Target     *TargetInfo    `json:"target,omitempty"`
+	URL        string         `json:"url,omitempty"`
 }
 
 type GetFollowInterface interface {
-	get() (*sqlx.Rows, error)
-	scan(*sqlx.Rows) (interface{}, error)
+	get(ctx context.Context) (*sqlx.Rows, error)
+	scan(ctx context.Context, rows *sqlx.Rows) (interface{}, error)
 }
 
 type GetFollowingArgs struct {
@@ -81,12 +151,32 @@ type GetFollowingArgs struct {
 	MaxResult int    `form:"max_result"`
 	Page      int    `form:"page"`
 	TargetIDs []int
-	Active    map[string][]int
+	// Active and PublishStatus filter the followed targets, e.g. {"$in": [1]}.
+	// They apply to each resource whose table has the column.
+	Active        map[string][]int `json:"active"`
+	PublishStatus map[string][]int `json:"publish_status"`
+	Filter        rrsql.Filter     `json:"filter"`
+	Sort          string           `form:"sort" json:"sort"`
+	EmbedArgs
 	Resource
 	Resources []string
 }
 
-func (g *GetFollowingArgs) get() (*sqlx.Rows, error) {
+// FollowingSortFields whitelists the fields GetFollowingArgs.Sort may use
+var FollowingSortFields = map[string]string{
+	"created_at": "f.created_at",
+	"target_id":  "f.target_id",
+	"type":       "f.type",
+}
+
+// FollowingFilterFields whitelists the fields GetFollowingArgs.Filter may use
+var FollowingFilterFields = map[string]string{
+	"created_at": "f.created_at",
+	"target_id":  "f.target_id",
+	"type":       "f.type",
+}
+
+func (g *GetFollowingArgs) get(ctx context.Context) (*sqlx.Rows, error) {
 	// change resource name to int type
 	followType := make([]int, 0)
 	for _, resourceName := range g.Resources {
@@ -99,31 +189,82 @@ func (g *GetFollowingArgs) get() (*sqlx.Rows, error) {
 
 	var osql = FollowingSQL{
 		base: `SELECT f.type, f.target_id, f.created_at FROM following AS f %s 
-		WHERE %s ORDER BY f.created_at DESC %s;`,
+		WHERE %s ORDER BY %s %s;`,
 		printargs: []interface{}{},
 		condition: []string{"f.type IN (?)", "f.member_id = ?", "f.emotion = ?"},
 		args:      []interface{}{followType, g.MemberID, 0},
 	}
-	// Append post's type filter to printarg
-	if g.ResourceType != "" {
-		if val, ok := config.Config.Models.PostType[g.ResourceType]; ok {
-			osql.AppendPrintarg(` LEFT JOIN posts AS p ON f.target_id = p.post_id `)
-			osql.AppendCondition(fmt.Sprintf(" NOT (p.type <> ? AND f.type = %d)", config.Config.Models.FollowingType["post"]))
-			osql.AppendArg(val)
-		} else if g.ResourceType != "" {
-			return nil, errors.New("Invalid Post Type")
+	// Private follows are only listed to their owner
+	if g.Viewer != g.MemberID {
+		osql.AppendCondition("f.visibility = ?")
+		osql.AppendArg(visibility("public"))
+	}
+	// Join each requested resource's own table to filter by its sub-type, active and publish status.
+	// Follows of other resources pass the OR unfiltered, and follows of missing targets drop out.
+	joins := make([]string, 0)
+	typeMatched := false
+	for _, resourceName := range g.Resources {
+		res, err := registry.Get(resourceName)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		osql.AppendPrintarg("")
+		alias := "t_" + res.Name
+		filters := make([]string, 0)
+		filterArgs := make([]interface{}, 0)
+
+		if val, ok := res.TypeValue(g.ResourceType); ok && g.ResourceType != "" {
+			typeMatched = true
+			filters = append(filters, fmt.Sprintf("%s.%s = ?", alias, res.TypeColumn))
+			filterArgs = append(filterArgs, val)
+		}
+		for _, status := range []struct {
+			column string
+			args   map[string][]int
+		}{{res.ActiveColumn, g.Active}, {res.PublishColumn, g.PublishStatus}} {
+			if status.column == "" {
+				continue
+			}
+			for op, values := range status.args {
+				if len(values) == 0 {
+					continue
+				}
+				filters = append(filters, fmt.Sprintf("%s.%s %s (?)", alias, status.column, rrsql.OperatorHelper(op)))
+				filterArgs = append(filterArgs, values)
+			}
+		}
+		if len(filters) == 0 {
+			continue
+		}
+		joins = append(joins, fmt.Sprintf(` LEFT JOIN %s AS %s ON f.target_id = %s.%s AND f.type = %d `, res.Table, alias, alias, res.PrimaryKey, res.FollowType))
+		osql.AppendCondition(fmt.Sprintf("(f.type <> %d OR (%s))", res.FollowType, strings.Join(filters, " AND ")))
+		osql.args = append(osql.args, filterArgs...)
 	}
+	if g.ResourceType != "" && !typeMatched {
+		return nil, errors.New("Invalid Resource Type")
+	}
+	osql.AppendPrintarg(strings.Join(joins, ""))
 
 	if len(g.TargetIDs) > 0 {
 		osql.AppendCondition("f.target_id IN (?)")
 		osql.AppendArg(g.TargetIDs)
 	}
 
+	if err := osql.appendFilter(g.Filter, FollowingFilterFields); err != nil {
+		return nil, err
+	}
+
 	osql.AppendPrintarg(strings.Join(osql.condition, " AND "))
 
+	sort := g.Sort
+	if sort == "" {
+		sort = "-created_at"
+	}
+	orderBy, err := OrderBy(sort, FollowingSortFields)
+	if err != nil {
+		return nil, err
+	}
+	osql.AppendPrintarg(orderBy)
+
 	if g.MaxResult != 0 {
 		if g.Page != 0 {
 			osql.AppendPrintarg(" LIMIT ? OFFSET ? ")
@@ -139,14 +280,15 @@ func (g *GetFollowingArgs) get() (*sqlx.Rows, error) {
 	query, args, err := sqlx.In(osql.SQL(), osql.args...)
 	query = rrsql.DB.Rebind(query)
 
-	rows, err := rrsql.DB.Queryx(query, args...)
+	rows, err := rrsql.DB.QueryxContext(ctx, query, args...)
 	if err != nil {
+		logger.FromContext(ctx).WithError(err).WithField("member_id", g.MemberID).Error("Get following error")
 		return nil, err
 	}
 	return rows, err
 }
 
-func (g *GetFollowingArgs) scan(rows *sqlx.Rows) (result interface{}, err error) {
+func (g *GetFollowingArgs) scan(ctx context.Context, rows *sqlx.Rows) (result interface{}, err error) {
 
 	if g.Mode == "id" {
 		var followingIDs []int
@@ -154,7 +296,7 @@ func (g *GetFollowingArgs) scan(rows *sqlx.Rows) (result interface{}, err error)
 			var f FollowingItem
 			err = rows.StructScan(&f)
 			if err != nil {
-				log.Println(fmt.Sprintf("Fail Scan Following Items: %v", err.Error()))
+				logger.FromContext(ctx).WithError(err).Warn("Fail Scan Following Items")
 			}
 			followingIDs = append(followingIDs, f.TargetID)
 		}
@@ -171,48 +313,221 @@ func (g *GetFollowingArgs) scan(rows *sqlx.Rows) (result interface{}, err error)
 		followingResults = append(followingResults, f)
 	}
 
+	// Embed profiles of the followed members
+	if g.embeds("members") {
+		res, err := registry.Get("member")
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int64, 0)
+		for _, f := range followingResults {
+			if f.Type == res.FollowType {
+				ids = append(ids, int64(f.TargetID))
+			}
+		}
+		profiles, err := g.hydrateMembers(ctx, ids)
+		if err != nil {
+			logger.FromContext(ctx).WithError(err).Error("Embed following members error")
+			return nil, err
+		}
+		for i, f := range followingResults {
+			if p, ok := profiles[int64(f.TargetID)]; ok && f.Type == res.FollowType {
+				followingResults[i].Member = &p
+			}
+		}
+	}
+
+	// Embed targets and their URLs with one query per resource among the results
+	if g.embeds("target") || g.embeds("url") {
+		ids := make(map[int][]int64)
+		for _, f := range followingResults {
+			ids[f.Type] = append(ids[f.Type], int64(f.TargetID))
+		}
+		for followType, targetIDs := range ids {
+			res, err := registry.ByFollowType(followType)
+			if err != nil {
+				continue
+			}
+			targets, urls := map[int64]TargetInfo{}, map[int64]string{}
+			if g.embeds("target") {
+				if targets, err = hydrateTargets(ctx, res, targetIDs); err != nil {
+					logger.FromContext(ctx).WithError(err).WithField("resource", res.Name).Error("Embed following targets error")
+					return nil, err
+				}
+			}
+			if g.embeds("url") {
+				if urls, err = resourceURLs(ctx, res, targetIDs); err != nil {
+					logger.FromContext(ctx).WithError(err).WithField("resource", res.Name).Error("Embed following URLs error")
+					return nil, err
+				}
+			}
+			for i, f := range followingResults {
+				if f.Type != followType {
+					continue
+				}
+				if t, ok := targets[int64(f.TargetID)]; ok {
+					followingResults[i].Target = &t
+				}
+				followingResults[i].URL = urls[int64(f.TargetID)]
+			}
+		}
+	}
+
 	return followingResults, err
 }
 
 func (g *GetFollowingArgs) getFollowType(resourceName string) (t int, err error) {
-	if val, ok := config.Config.Models.FollowingType[resourceName]; ok {
-		return val, nil
+	if r, err := registry.Get(resourceName); err == nil {
+		return r.FollowType, nil
 	}
 	return t, errors.New("Unsupported Following Type")
 }
 
 /* ================================================ Get Followed ================================================ */
 
+// GetFollowedArgs counts the followers of IDs. Without Filter the counts come from follow_counters,
+// which include follows of members missing from the members table until cleanup removes them.
 type GetFollowedArgs struct {
-	IDs []int64 `json:"ids"`
+	IDs    []int64      `json:"ids"`
+	Filter rrsql.Filter `json:"filter"`
+	Sort   string       `form:"sort" json:"sort"`
+	// OmitFollowers leaves Followers out and only counts.
+	// FollowerLimit keeps the most recent followers of each target, at most and by default MaxFollowerLimit.
+	OmitFollowers bool `form:"omit_followers" json:"omit_followers"`
+	FollowerLimit int  `form:"follower_limit" json:"follower_limit"`
+	EmbedArgs
 	Resource
 }
 
+// MaxFollowerLimit caps FollowerLimit, so the concatenated IDs fit in group_concat_max_len
+const MaxFollowerLimit = 100
+
+// FollowerConcatLen is the group_concat_max_len, in bytes, the connection needs so that
+// MaxFollowerLimit BIGINT IDs and their separators are never cut by GROUP_CONCAT
+const FollowerConcatLen = MaxFollowerLimit * 21
+
+// FollowedSortFields whitelists the fields GetFollowedArgs.Sort may use, e.g. "-count" for most followed first
+var FollowedSortFields = map[string]string{
+	"count":     "count",
+	"target_id": "target_id",
+}
+
+// FollowedFilterFields whitelists the fields GetFollowedArgs.Filter may use.
+// The filter applies to follow rows before they are counted.
+var FollowedFilterFields = map[string]string{
+	"created_at": "f.created_at",
+	"member_id":  "f.member_id",
+	"target_id":  "f.target_id",
+}
+
 type FollowedCount struct {
 	ResourceID int64   `json:"ResourceID"`
 	Count      int     `json:"Count"`
-	Followers  []int64 `json:"Followers"`
+	Followers  []int64 `json:"Followers,omitempty"`
+	// Members are the profiles of Followers, in their order, with embed=members
+	Members []MemberProfile `json:"Members,omitempty"`
+	URL     string          `json:"URL,omitempty"`
 }
 
-func (g *GetFollowedArgs) get() (*sqlx.Rows, error) {
+// followerColumn aggregates the follower IDs of col according to OmitFollowers and FollowerLimit
+func (g *GetFollowedArgs) followerColumn(col string) string {
+	// Private followers are left out, except the viewer, and so are blocked followers
+	show := fmt.Sprintf("(f.visibility = %d OR f.member_id = %d)", visibility("public"), g.Viewer)
+	if blocked := g.notBlocked(); blocked != "" {
+		show += " AND " + blocked
+	}
+	col = fmt.Sprintf("CASE WHEN %s THEN %s END", show, col)
+	if g.OmitFollowers {
+		return "''"
+	}
+	// An uncapped list would be cut at group_concat_max_len, possibly in the middle of an ID
+	limit := g.FollowerLimit
+	if limit <= 0 || limit > MaxFollowerLimit {
+		limit = MaxFollowerLimit
+	}
+	return fmt.Sprintf("IFNULL(SUBSTRING_INDEX(GROUP_CONCAT(%s ORDER BY f.created_at DESC SEPARATOR ','), ',', %d), '')", col, limit)
+}
 
+func (g *GetFollowedArgs) get(ctx context.Context) (*sqlx.Rows, error) {
+
+	// Without a filter every follow is counted, so count comes from follow_counters
+	// instead of counting the following rows of each target.
+	// The counters include private follows, so they cannot serve counts without them.
+	// They also include follows of members missing from the member table, which the member join
+	// below leaves out, until the cleanup command removes those follows.
+	countPrivate := config.Current().Privacy.CountPrivate
 	var osql = FollowingSQL{
-		base: `SELECT f.target_id, COUNT(m.id) as count, 
-		GROUP_CONCAT(m.id SEPARATOR ',') as follower FROM following as f 
-		LEFT JOIN %s WHERE %s GROUP BY f.target_id;`,
-		condition: []string{"f.target_id IN (?)", "f.type = ?", "f.emotion = ?"},
-		join:      []string{"members AS m ON f.member_id = m.id"},
+		base: `SELECT c.target_id, c.count, 
+		%s as follower FROM follow_counters AS c 
+		%s WHERE %s GROUP BY c.target_id, c.count %s;`,
+		printargs: []interface{}{g.followerColumn("f.member_id")},
+		condition: []string{"c.target_id IN (?)", "c.type = ?", "c.emotion = ?", "c.count > 0"},
+		join:      []string{"following AS f ON f.type = c.type AND f.target_id = c.target_id AND f.emotion = c.emotion"},
 		args:      []interface{}{g.IDs, g.FollowType, g.Emotion},
 	}
-	query, args, err := sqlx.In(fmt.Sprintf(osql.base, strings.Join(osql.join, " LEFT JOIN "), strings.Join(osql.condition, " AND ")), osql.args...)
+	alias := "c"
+	if g.OmitFollowers {
+		osql.join = []string{}
+	}
+	if len(g.Filter) > 0 || !countPrivate {
+		member, err := registry.Get("member")
+		if err != nil {
+			return nil, err
+		}
+		memberID := "m." + member.PrimaryKey
+		osql = FollowingSQL{
+			base: `SELECT f.target_id, COUNT(` + memberID + `) as count, 
+			%s as follower FROM following as f 
+			%s WHERE %s GROUP BY f.target_id %s;`,
+			printargs: []interface{}{g.followerColumn(memberID)},
+			condition: []string{"f.target_id IN (?)", "f.type = ?", "f.emotion = ?"},
+			join:      []string{fmt.Sprintf("%s AS m ON f.member_id = %s", member.Table, memberID)},
+			args:      []interface{}{g.IDs, g.FollowType, g.Emotion},
+		}
+		alias = "f"
+		if !countPrivate {
+			osql.AppendCondition("(f.visibility = ? OR f.member_id = ?)")
+			osql.args = append(osql.args, visibility("public"), g.Viewer)
+		}
+	}
+	if g.ResourceType != "" {
+		res, err := registry.Get(g.ResourceName)
+		if err != nil {
+			return nil, err
+		}
+		val, ok := res.TypeValue(g.ResourceType)
+		if !ok {
+			return nil, errors.New("Invalid Resource Type")
+		}
+		osql.join = append(osql.join, fmt.Sprintf("%s AS t ON %s.target_id = t.%s", res.Table, alias, res.PrimaryKey))
+		osql.AppendCondition(fmt.Sprintf("t.%s = ?", res.TypeColumn))
+		osql.AppendArg(val)
+	}
+	if err := osql.appendFilter(g.Filter, FollowedFilterFields); err != nil {
+		return nil, err
+	}
+	var orderBy string
+	if g.Sort != "" {
+		sort, err := OrderBy(g.Sort, FollowedSortFields)
+		if err != nil {
+			return nil, err
+		}
+		orderBy = "ORDER BY " + sort
+	}
+	var joins string
+	for _, join := range osql.join {
+		joins += " LEFT JOIN " + join
+	}
+	osql.printargs = append(osql.printargs, joins, strings.Join(osql.condition, " AND "), orderBy)
+	query, args, err := sqlx.In(osql.SQL(), osql.args...)
 	if err != nil {
 		return nil, err
 	}
 	query = rrsql.DB.Rebind(query)
-	return rrsql.DB.Queryx(query, args...)
+	return rrsql.DB.QueryxContext(ctx, query, args...)
 }
 
-func (g *GetFollowedArgs) scan(rows *sqlx.Rows) (interface{}, error) {
+func (g *GetFollowedArgs) scan(ctx context.Context, rows *sqlx.Rows) (interface{}, error) {
 
 	var (
 		followed []FollowedCount
@@ -226,22 +541,174 @@ func (g *GetFollowedArgs) scan(rows *sqlx.Rows) (interface{}, error) {
 		)
 		err = rows.Scan(&resourceID, &count, &follower)
 		if err != nil {
-			log.Fatalln(err.Error())
+			logger.FromContext(ctx).WithError(err).Error("Scan followed count error")
 			return nil, err
 		}
 		var followers []int64
 		for _, v := range strings.Split(follower, ",") {
+			if v == "" {
+				continue
+			}
 			i, err := strconv.Atoi(v)
 			if err != nil {
 				return nil, err
 			}
 			followers = append(followers, int64(i))
 		}
-		followed = append(followed, FollowedCount{resourceID, count, followers})
+		followed = append(followed, FollowedCount{ResourceID: resourceID, Count: count, Followers: followers})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if g.embeds("url") {
+		res, err := registry.Get(g.ResourceName)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int64, 0)
+		for _, f := range followed {
+			ids = append(ids, f.ResourceID)
+		}
+		urls, err := resourceURLs(ctx, res, ids)
+		if err != nil {
+			logger.FromContext(ctx).WithError(err).Error("Embed followed URLs error")
+			return nil, err
+		}
+		for i, f := range followed {
+			followed[i].URL = urls[f.ResourceID]
+		}
+	}
+	if g.embeds("members") {
+		ids := make([]int64, 0)
+		for _, f := range followed {
+			ids = append(ids, f.Followers...)
+		}
+		profiles, err := g.hydrateMembers(ctx, ids)
+		if err != nil {
+			logger.FromContext(ctx).WithError(err).Error("Embed followers error")
+			return nil, err
+		}
+		for i, f := range followed {
+			for _, id := range f.Followers {
+				if p, ok := profiles[id]; ok {
+					followed[i].Members = append(followed[i].Members, p)
+				}
+			}
+		}
 	}
 	return followed, err
 }
 
+/* ================================================ Get Followers ================================================ */
+
+// GetFollowersArgs pages through the followers of one target, most recent first
+type GetFollowersArgs struct {
+	ID int64 `form:"id" json:"id"`
+	Resource
+}
+
+type FollowerItem struct {
+	MemberID   int64          `db:"member_id" json:"member_id"`
+	FollowedAt rrsql.NullTime `db:"created_at" json:"followed_at"`
+}
+
+func (g *GetFollowersArgs) get(ctx context.Context) (*sqlx.Rows, error) {
+
+	var osql = FollowingSQL{
+		base:      `SELECT f.member_id, f.created_at FROM following AS f WHERE %s ORDER BY f.created_at DESC, f.member_id DESC LIMIT ? OFFSET ?;`,
+		condition: []string{"f.target_id = ?", "f.type = ?", "f.emotion = ?", "(f.visibility = ? OR f.member_id = ?)"},
+		args:      []interface{}{g.ID, g.FollowType, g.Emotion, visibility("public"), g.Viewer},
+	}
+	if blocked := g.notBlocked(); blocked != "" {
+		osql.AppendCondition(blocked)
+	}
+	osql.args = append(osql.args, g.MaxResult, (g.Page-1)*g.MaxResult)
+	osql.AppendPrintarg(strings.Join(osql.condition, " AND "))
+	return rrsql.DB.QueryxContext(ctx, osql.SQL(), osql.args...)
+}
+
+func (g *GetFollowersArgs) scan(ctx context.Context, rows *sqlx.Rows) (interface{}, error) {
+	followers := make([]FollowerItem, 0)
+	for rows.Next() {
+		var item FollowerItem
+		if err := rows.StructScan(&item); err != nil {
+			logger.FromContext(ctx).WithError(err).Error("Scan follower error")
+			return nil, err
+		}
+		followers = append(followers, item)
+	}
+	return followers, rows.Err()
+}
+
+/* ================================================ Get Leaderboard ================================================ */
+
+// GetLeaderboardArgs ranks targets of one resource by how many follows or emotions
+// they received since Since, counting only active and published targets
+type GetLeaderboardArgs struct {
+	Since  time.Time
+	Window string
+	Resource
+}
+
+type LeaderboardItem struct {
+	ResourceID int64 `db:"target_id" json:"resource_id"`
+	Count      int   `db:"count" json:"count"`
+}
+
+func (g *GetLeaderboardArgs) get(ctx context.Context) (*sqlx.Rows, error) {
+	res, err := registry.Get(g.ResourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	var osql = FollowingSQL{
+		base: `SELECT f.target_id, COUNT(*) AS count FROM following AS f 
+		LEFT JOIN %s WHERE %s GROUP BY f.target_id ORDER BY count DESC, f.target_id LIMIT ?;`,
+		join:      []string{fmt.Sprintf("%s AS t ON f.target_id = t.%s", res.Table, res.PrimaryKey)},
+		condition: []string{"f.type = ?", "f.emotion = ?"},
+		args:      []interface{}{res.FollowType, g.Emotion},
+	}
+	if !g.Since.IsZero() {
+		osql.AppendCondition("f.created_at >= ?")
+		osql.AppendArg(g.Since)
+	}
+	if g.ResourceType != "" {
+		val, ok := res.TypeValue(g.ResourceType)
+		if !ok {
+			return nil, errors.New("Invalid Resource Type")
+		}
+		osql.AppendCondition(fmt.Sprintf("t.%s = ?", res.TypeColumn))
+		osql.AppendArg(val)
+	}
+	osql.appendAvailable("t", res)
+	osql.AppendArg(g.MaxResult)
+
+	return rrsql.DB.QueryxContext(ctx, fmt.Sprintf(osql.base, strings.Join(osql.join, " LEFT JOIN "), strings.Join(osql.condition, " AND ")), osql.args...)
+}
+
+func (g *GetLeaderboardArgs) scan(ctx context.Context, rows *sqlx.Rows) (interface{}, error) {
+	items := make([]LeaderboardItem, 0)
+	for rows.Next() {
+		var item LeaderboardItem
+		if err := rows.StructScan(&item); err != nil {
+			logger.FromContext(ctx).WithError(err).Error("Scan leaderboard item error")
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// cacheKey uses Window instead of Since, so requests for the same window share an entry
+func (g *GetLeaderboardArgs) cacheKey() string {
+	return fmt.Sprintf("leaderboard:%s:%s:%d:%s:%d", g.ResourceName, g.ResourceType, g.Emotion, g.Window, g.MaxResult)
+}
+
+func (g *GetLeaderboardArgs) cacheTTL() time.Duration {
+	return time.Duration(config.Current().Leaderboard.CacheTTL) * time.Second
+}
+
 /* ================================================ Get Follow Map ================================================ */
 
 type GetFollowMapArgs struct {
@@ -249,44 +716,63 @@ type GetFollowMapArgs struct {
 	Resource
 }
 
-func (g *GetFollowMapArgs) get() (*sqlx.Rows, error) {
+func (g *GetFollowMapArgs) get(ctx context.Context) (*sqlx.Rows, error) {
+	members, err := registry.Get("member")
+	if err != nil {
+		return nil, err
+	}
+	target, err := registry.Get(g.ResourceName)
+	if err != nil {
+		return nil, err
+	}
+	memberActive, _ := members.ActiveValue()
+
 	var osql = FollowingSQL{
 		base: `SELECT GROUP_CONCAT(member_resource.member_id) AS member_ids, member_resource.resource_ids
 			FROM (
-				SELECT GROUP_CONCAT(f.target_id) AS resource_ids, m.id AS member_id 
+				SELECT GROUP_CONCAT(f.target_id) AS resource_ids, f.member_id 
 				FROM following AS f
 				LEFT JOIN %s
 				WHERE %s
-				GROUP BY m.id
+				GROUP BY f.member_id
 				) AS member_resource
 			GROUP BY member_resource.resource_ids;`,
-		join:      []string{"members AS m ON f.member_id = m.id", fmt.Sprintf("%s AS t ON f.target_id = t.%s", g.Table, g.PrimaryKey)},
-		condition: []string{"m.active = ?", "m.post_push = ?", "f.type = ?"},
-		args:      []interface{}{config.Config.Models.Members["active"], 1, g.FollowType},
+		join: []string{
+			fmt.Sprintf("%s AS m ON f.member_id = m.%s", members.Table, members.PrimaryKey),
+			fmt.Sprintf("%s AS t ON f.target_id = t.%s", target.Table, target.PrimaryKey),
+		},
+		condition: []string{fmt.Sprintf("m.%s = ?", members.ActiveColumn), "m.post_push = ?", "f.type = ?"},
+		args:      []interface{}{memberActive, 1, target.FollowType},
 	}
 
+	// Only members, posts and projects filter their targets; other resources map every follow
 	switch g.ResourceName {
 	case "member":
-		osql.join = append(osql.join, "posts AS p ON f.target_id = p.author")
-		osql.condition = append(osql.condition, "t.active = ?", "p.active = ?", "p.publish_status = ?", "p.updated_at > ?")
-		osql.args = append(osql.args, config.Config.Models.Members["active"], config.Config.Models.Posts["active"], config.Config.Models.PostPublishStatus["publish"], g.UpdateAfter)
-	case "post":
-		osql.condition = append(osql.condition, "t.active = ?", "t.publish_status = ?", "t.updated_at > ?")
-		osql.args = append(osql.args, config.Config.Models.Posts["active"], config.Config.Models.PostPublishStatus["publish"], g.UpdateAfter)
-	case "project":
-		osql.condition = append(osql.condition, "t.active = ?", "t.publish_status = ?", "t.updated_at > ?")
-		osql.args = append(osql.args, config.Config.Models.ProjectsActive["active"], config.Config.Models.ProjectsPublishStatus["publish"], g.UpdateAfter)
-	}
-
-	rows, err := rrsql.DB.Queryx(fmt.Sprintf(osql.base, strings.Join(osql.join, " LEFT JOIN "), strings.Join(osql.condition, " AND ")), osql.args...)
+		// Followed members are mapped through their newly updated posts
+		posts, err := registry.Get("post")
+		if err != nil {
+			return nil, err
+		}
+		osql.appendAvailable("t", target)
+		osql.join = append(osql.join, fmt.Sprintf("%s AS p ON f.target_id = p.author", posts.Table))
+		osql.appendAvailable("p", posts)
+		osql.AppendCondition("p.updated_at > ?")
+		osql.AppendArg(g.UpdateAfter)
+	case "post", "project":
+		osql.appendAvailable("t", target)
+		osql.AppendCondition("t.updated_at > ?")
+		osql.AppendArg(g.UpdateAfter)
+	}
+
+	rows, err := rrsql.DB.QueryxContext(ctx, fmt.Sprintf(osql.base, strings.Join(osql.join, " LEFT JOIN "), strings.Join(osql.condition, " AND ")), osql.args...)
 	if err != nil {
-		log.Println(err.Error())
+		logger.FromContext(ctx).WithError(err).WithField("resource", g.ResourceName).Error("Get follow map error")
 		return nil, err
 	}
 	return rows, err
 }
 
-func (g *GetFollowMapArgs) scan(rows *sqlx.Rows) (interface{}, error) {
+func (g *GetFollowMapArgs) scan(ctx context.Context, rows *sqlx.Rows) (interface{}, error) {
 
 	var (
 		list []FollowingMapItem
@@ -295,7 +781,7 @@ func (g *GetFollowMapArgs) scan(rows *sqlx.Rows) (interface{}, error) {
 	for rows.Next() {
 		var memberIDs, resourceIDs string
 		if err = rows.Scan(&memberIDs, &resourceIDs); err != nil {
-			log.Println(err)
+			logger.FromContext(ctx).WithError(err).Error("Scan follow map error")
 			return []FollowingMapItem{}, err
 		}
 		list = append(list, FollowingMapItem{
@@ -317,20 +803,20 @@ type FollowingMapItem struct {
 	ResourceIDs []string `json:"resource_ids" db:"resource_ids"`
 }
 
-func (g *GetFollowerMemberIDsArgs) get() (*sqlx.Rows, error) {
+func (g *GetFollowerMemberIDsArgs) get(ctx context.Context) (*sqlx.Rows, error) {
 
 	query, args, err := sqlx.In(`SELECT member_id FROM following WHERE target_id = ? AND type = ? AND emotion IN (?);`, g.ID, g.FollowType, g.Emotions)
 	query = rrsql.DB.Rebind(query)
 
-	rows, err := rrsql.DB.Queryx(query, args...)
+	rows, err := rrsql.DB.QueryxContext(ctx, query, args...)
 	if err != nil {
-		log.Printf("Error: %v get Follower for id:%d, type:%d\n", err.Error(), g.ID, g.FollowType)
+		logger.FromContext(ctx).WithError(err).WithFields(logrus.Fields{"id": g.ID, "type": g.FollowType}).Error("Get follower error")
 	}
 	return rows, err
 
 }
 
-func (g *GetFollowerMemberIDsArgs) scan(rows *sqlx.Rows) (interface{}, error) {
+func (g *GetFollowerMemberIDsArgs) scan(ctx context.Context, rows *sqlx.Rows) (interface{}, error) {
 	var (
 		result []int
 		err    error
@@ -339,7 +825,7 @@ func (g *GetFollowerMemberIDsArgs) scan(rows *sqlx.Rows) (interface{}, error) {
 		var follower int
 		err = rows.Scan(&follower)
 		if err != nil {
-			log.Printf("Error: %v scan for id:%d, type:%d\n", err.Error(), g.ID, g.FollowType)
+			logger.FromContext(ctx).WithError(err).WithFields(logrus.Fields{"id": g.ID, "type": g.FollowType}).Error("Scan follower error")
 			return nil, err
 		}
 		result = append(result, follower)
@@ -352,59 +838,188 @@ func (g *GetFollowerMemberIDsArgs) scan(rows *sqlx.Rows) (interface{}, error) {
 type followingAPI struct{}
 
 type FollowingAPIInterface interface {
-	Get(params GetFollowInterface) (interface{}, error)
-	Insert(params FollowArgs) error
-	Update(params FollowArgs) error
-	Delete(params FollowArgs) error
+	Get(ctx context.Context, params GetFollowInterface) (interface{}, error)
+	Insert(ctx context.Context, params FollowArgs) error
+	Update(ctx context.Context, params FollowArgs) error
+	Delete(ctx context.Context, params FollowArgs) error
+	SetVisibility(ctx context.Context, params FollowArgs) error
+	UpdateBlock(ctx context.Context, params BlockArgs) (int, error)
+	UpdateMember(ctx context.Context, params MemberArgs) (int, error)
+	ExportMember(ctx context.Context, memberID int64) (MemberExport, error)
+	EraseMember(ctx context.Context, memberID int64) (ErasureReceipt, error)
+	MergeMember(ctx context.Context, params MergeArgs) (MergeReport, error)
 }
 
-func (f *followingAPI) Get(params GetFollowInterface) (result interface{}, err error) {
+// queryName labels params for metrics
+func queryName(params GetFollowInterface) string {
+	switch params.(type) {
+	case *GetFollowingArgs:
+		return "following"
+	case *GetFollowedArgs:
+		return "followed"
+	case *GetFollowMapArgs:
+		return "follow_map"
+	case *GetFollowerMemberIDsArgs:
+		return "follower_member_ids"
+	case *GetLeaderboardArgs:
+		return "leaderboard"
+	case *GetFollowersArgs:
+		return "followers"
+	default:
+		return "unknown"
+	}
+}
+
+func (f *followingAPI) Get(ctx context.Context, params GetFollowInterface) (result interface{}, err error) {
 
 	var rows *sqlx.Rows
+	defer func(start time.Time) {
+		metrics.ObserveQuery(queryName(params), start, result)
+	}(time.Now())
+
+	c, isCacheable := params.(cacheable)
+	if isCacheable && c.cacheTTL() > 0 {
+		if cached, ok := queryCache.get(c.cacheKey()); ok {
+			return cached, nil
+		}
+		defer func() {
+			if err == nil {
+				queryCache.set(c.cacheKey(), result, c.cacheTTL())
+			}
+		}()
+	}
 
-	rows, err = params.get()
+	name := queryName(params)
+	getCtx, span := tracing.Start(ctx, name+".get")
+	rows, err = params.get(getCtx)
+	tracing.End(span, err)
 	if err != nil {
-		log.Println("Error Get Follow with params.get()")
+		logger.FromContext(ctx).WithError(err).WithField("query", name).Error("Error Get Follow with params.get()")
 		return nil, err
 	}
-	return params.scan(rows)
+	defer rows.Close()
+
+	scanCtx, span := tracing.Start(ctx, name+".scan")
+	result, err = params.scan(scanCtx, rows)
+	tracing.End(span, err)
+	return result, err
+}
+
+// checkTarget enforces the target_validation mode of the followed resource,
+// returning rrsql.TargetNotFoundError if the target is missing or unavailable
+func checkTarget(ctx context.Context, tx *rrsql.Tx, params FollowArgs) error {
+	res, err := registry.ByFollowType(params.Type)
+	if err != nil || res.TargetCheck == "" {
+		return nil
+	}
+	var osql = FollowingSQL{
+		base:      `SELECT COUNT(*) FROM %s AS t WHERE %s;`,
+		printargs: []interface{}{res.Table},
+		condition: []string{fmt.Sprintf("t.%s = ?", res.PrimaryKey)},
+		args:      []interface{}{params.Object},
+	}
+	if res.TargetCheck == "available" {
+		osql.appendAvailable("t", res)
+	}
+	osql.AppendPrintarg(strings.Join(osql.condition, " AND "))
+
+	var count int
+	if err = tx.GetContext(ctx, &count, osql.SQL(), osql.args...); err != nil {
+		return err
+	}
+	if count == 0 {
+		return rrsql.TargetNotFoundError
+	}
+	return nil
 }
 
-func (f *followingAPI) Insert(params FollowArgs) (err error) {
+func (f *followingAPI) Insert(ctx context.Context, params FollowArgs) (err error) {
 
-	query := `INSERT INTO following (member_id, target_id, type, emotion) VALUES ( ?, ?, ?, ?);`
+	query := `INSERT INTO following (member_id, target_id, type, emotion, visibility) VALUES ( ?, ?, ?, ?, ?);`
 
-	result, err := rrsql.DB.Exec(query, params.Subject, params.Object, params.Type, params.Emotion)
+	err = rrsql.DB.Transact(ctx, func(tx *rrsql.Tx) error {
+		if err := checkTarget(ctx, tx, params); err != nil {
+			return err
+		}
+		if err := checkBlocked(ctx, tx, params); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, query, params.Subject, params.Object, params.Type, params.Emotion, params.Visibility)
+		if err != nil {
+			return err
+		}
+		changed, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if changed == 0 {
+			return rrsql.SQLInsertionFail
+		}
+		return adjustCounter(ctx, tx, params.Type, params.Object, params.Emotion, 1)
+	})
 	if err != nil {
+		if err == rrsql.SQLInsertionFail || err == rrsql.TargetNotFoundError || err == rrsql.BlockedError {
+			return err
+		}
 		sqlerr, ok := err.(*mysql.MySQLError)
 		if ok && sqlerr.Number == 1062 {
 			return rrsql.DuplicateError
 		}
-		log.Println(err.Error())
+		logger.FromContext(ctx).WithError(err).WithFields(params.logFields()).Error("Insert following error")
 		return rrsql.InternalServerError
 	}
-	changed, err := result.RowsAffected()
+	return nil
+}
+
+func (f *followingAPI) Update(ctx context.Context, params FollowArgs) (err error) {
+
+	err = rrsql.DB.Transact(ctx, func(tx *rrsql.Tx) error {
+		// Lock the row to know which counter the previous emotion is kept in
+		var previous int
+		err := tx.GetContext(ctx, &previous, `SELECT emotion FROM following WHERE member_id = ? AND target_id = ? AND type = ? AND emotion != 0 FOR UPDATE;`, params.Subject, params.Object, params.Type)
+		if err == sql.ErrNoRows {
+			return rrsql.SQLUpdateFail
+		} else if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `UPDATE following SET emotion = ? WHERE member_id = ? AND target_id = ? AND type = ? AND emotion != 0;`, params.Emotion, params.Subject, params.Object, params.Type)
+		if err != nil {
+			return err
+		}
+		changed, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if changed == 0 {
+			return rrsql.SQLUpdateFail
+		}
+		if err = adjustCounter(ctx, tx, params.Type, params.Object, previous, -1); err != nil {
+			return err
+		}
+		return adjustCounter(ctx, tx, params.Type, params.Object, params.Emotion, 1)
+	})
 	if err != nil {
-		log.Println(err.Error())
+		if err == rrsql.SQLUpdateFail {
+			return err
+		}
+		logger.FromContext(ctx).WithError(err).WithFields(params.logFields()).Error("Update following error")
 		return rrsql.InternalServerError
 	}
-	if changed == 0 {
-		return rrsql.SQLInsertionFail
-	}
-
 	return nil
 }
 
-func (f *followingAPI) Update(params FollowArgs) (err error) {
+// SetVisibility makes a follow public or private. Counters are unaffected.
+func (f *followingAPI) SetVisibility(ctx context.Context, params FollowArgs) (err error) {
 
-	result, err := rrsql.DB.Exec(`UPDATE following SET emotion = ? WHERE member_id = ? AND target_id = ? AND type = ? AND emotion != 0;`, params.Emotion, params.Subject, params.Object, params.Type)
+	result, err := rrsql.DB.ExecContext(ctx, `UPDATE following SET visibility = ? WHERE member_id = ? AND target_id = ? AND type = ? AND emotion = 0;`, params.Visibility, params.Subject, params.Object, params.Type)
 	if err != nil {
-		log.Println(err.Error())
+		logger.FromContext(ctx).WithError(err).WithFields(params.logFields()).Error("Set following visibility error")
 		return rrsql.InternalServerError
 	}
 	changed, err := result.RowsAffected()
 	if err != nil {
-		log.Println(err.Error())
+		logger.FromContext(ctx).WithError(err).WithFields(params.logFields()).Error("Set following visibility error")
 		return rrsql.InternalServerError
 	}
 	if changed == 0 {
@@ -413,11 +1028,22 @@ func (f *followingAPI) Update(params FollowArgs) (err error) {
 	return nil
 }
 
-func (f *followingAPI) Delete(params FollowArgs) (err error) {
+func (f *followingAPI) Delete(ctx context.Context, params FollowArgs) (err error) {
 	query := `DELETE FROM following WHERE member_id = ? AND target_id = ? AND type = ? AND emotion = ?;`
-	_, err = rrsql.DB.Exec(query, params.Subject, params.Object, params.Type, params.Emotion)
+
+	err = rrsql.DB.Transact(ctx, func(tx *rrsql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, params.Subject, params.Object, params.Type, params.Emotion)
+		if err != nil {
+			return err
+		}
+		changed, err := result.RowsAffected()
+		if err != nil || changed == 0 {
+			return err
+		}
+		return adjustCounter(ctx, tx, params.Type, params.Object, params.Emotion, -int(changed))
+	})
 	if err != nil {
-		log.Fatal(err)
+		logger.FromContext(ctx).WithError(err).WithFields(params.logFields()).Error("Delete following error")
 	}
 
 	return err
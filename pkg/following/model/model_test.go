@@ -0,0 +1,40 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+)
+
+func TestMain(m *testing.M) {
+
+	_, err := config.LoadConfig("../../../config/main.json")
+	if err != nil {
+		panic(fmt.Errorf("Invalid application configuration: %s", err))
+	}
+	os.Exit(m.Run())
+}
+
+// mockDB points rrsql.DB at a sqlmock expecting statements in order, and checks
+// every expectation was met when the test ends
+func mockDB(t *testing.T) sqlmock.Sqlmock {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := rrsql.DB.DB
+	rrsql.DB.DB = sqlx.NewDb(db, "mysql")
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		rrsql.DB.DB = previous
+		db.Close()
+	})
+	return mock
+}
@@ -0,0 +1,190 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+)
+
+// ExportItem is one follow, reaction or archived follow of a member, with names instead of enumeration values
+type ExportItem struct {
+	Resource   string         `json:"resource"`
+	TargetID   int64          `json:"target_id"`
+	Emotion    string         `json:"emotion"`
+	CreatedAt  rrsql.NullTime `json:"created_at"`
+	ArchivedAt rrsql.NullTime `json:"archived_at,omitempty"`
+	Reason     string         `json:"reason,omitempty"`
+}
+
+// MemberExport is all follow data kept about a member
+type MemberExport struct {
+	MemberID   int64        `json:"member_id"`
+	Followings []ExportItem `json:"followings"`
+	Reactions  []ExportItem `json:"reactions"`
+	// History lists follows removed by cleanups and deactivations, from following_archive
+	History []ExportItem `json:"history"`
+	// Blocks lists the members the member blocked
+	Blocks []ExportItem `json:"blocks"`
+}
+
+// ErasureReceipt confirms an erasure. Only the counts are kept in erasure_receipts, not the member.
+type ErasureReceipt struct {
+	ReceiptID  string    `db:"receipt_id" json:"receipt_id"`
+	MemberID   int64     `db:"-" json:"member_id"`
+	Follows    int       `db:"follows" json:"follows"`
+	Reactions  int       `db:"reactions" json:"reactions"`
+	Anonymized int       `db:"anonymized" json:"anonymized"`
+	Blocks     int       `db:"blocks" json:"blocks"`
+	ErasedAt   time.Time `db:"erased_at" json:"erased_at"`
+}
+
+// WriteCSV writes the export as one CSV row per item, with its section in the first column
+func (e MemberExport) WriteCSV(w io.Writer) error {
+	formatTime := func(t rrsql.NullTime) string {
+		if !t.Valid {
+			return ""
+		}
+		return t.Time.Format(time.RFC3339)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"section", "member_id", "resource", "target_id", "emotion", "created_at", "archived_at", "reason"})
+	for _, section := range []struct {
+		name  string
+		items []ExportItem
+	}{{"followings", e.Followings}, {"reactions", e.Reactions}, {"history", e.History}, {"blocks", e.Blocks}} {
+		for _, item := range section.items {
+			cw.Write([]string{section.name, strconv.FormatInt(e.MemberID, 10), item.Resource, strconv.FormatInt(item.TargetID, 10),
+				item.Emotion, formatTime(item.CreatedAt), formatTime(item.ArchivedAt), item.Reason})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type exportRow struct {
+	followKey
+	CreatedAt  rrsql.NullTime `db:"created_at"`
+	ArchivedAt rrsql.NullTime `db:"archived_at"`
+	Reason     string         `db:"reason"`
+}
+
+func (r exportRow) item(emotions map[int]string) ExportItem {
+	item := ExportItem{TargetID: r.TargetID, Emotion: emotions[r.Emotion], CreatedAt: r.CreatedAt, ArchivedAt: r.ArchivedAt, Reason: r.Reason}
+	if res, err := registry.ByFollowType(r.Type); err == nil {
+		item.Resource = res.Name
+	}
+	return item
+}
+
+func (f *followingAPI) ExportMember(ctx context.Context, memberID int64) (export MemberExport, err error) {
+	emotions := make(map[int]string)
+	for name, v := range config.Current().Models.Emotions {
+		emotions[v] = name
+	}
+	export = MemberExport{MemberID: memberID, Followings: []ExportItem{}, Reactions: []ExportItem{}, History: []ExportItem{}, Blocks: []ExportItem{}}
+
+	var rows []exportRow
+	if err = rrsql.DB.SelectContext(ctx, &rows, `SELECT member_id, target_id, type, emotion, created_at 
+	FROM following WHERE member_id = ? ORDER BY created_at;`, memberID); err != nil {
+		return export, err
+	}
+	for _, r := range rows {
+		if r.Emotion == 0 {
+			export.Followings = append(export.Followings, r.item(emotions))
+		} else {
+			export.Reactions = append(export.Reactions, r.item(emotions))
+		}
+	}
+
+	rows = nil
+	if err = rrsql.DB.SelectContext(ctx, &rows, `SELECT member_id, target_id, type, emotion, created_at, archived_at, reason 
+	FROM following_archive WHERE member_id = ? ORDER BY archived_at;`, memberID); err != nil {
+		return export, err
+	}
+	for _, r := range rows {
+		export.History = append(export.History, r.item(emotions))
+	}
+
+	var blocks []struct {
+		BlockedID int64          `db:"blocked_id"`
+		CreatedAt rrsql.NullTime `db:"created_at"`
+	}
+	if err = rrsql.DB.SelectContext(ctx, &blocks, `SELECT blocked_id, created_at FROM member_blocks WHERE member_id = ? ORDER BY created_at;`, memberID); err != nil {
+		return export, err
+	}
+	for _, b := range blocks {
+		export.Blocks = append(export.Blocks, ExportItem{Resource: "member", TargetID: b.BlockedID, CreatedAt: b.CreatedAt})
+	}
+	return export, nil
+}
+
+// EraseMember deletes the follows, reactions and blocks of a member, anonymizes their following_archive rows,
+// both the ones they followed from and the archived follows of them, detaches those rows from any deactivation
+// so they are never restored, and records a receipt, all in one transaction
+func (f *followingAPI) EraseMember(ctx context.Context, memberID int64) (receipt ErasureReceipt, err error) {
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return receipt, err
+	}
+	receipt = ErasureReceipt{ReceiptID: hex.EncodeToString(id), MemberID: memberID, ErasedAt: time.Now().UTC().Truncate(time.Second)}
+	member, err := registry.Get("member")
+	if err != nil {
+		return receipt, err
+	}
+	var anonymizedTargets int
+
+	err = rrsql.DB.Transact(ctx, func(tx *rrsql.Tx) error {
+		var keys []followKey
+		if err := tx.SelectContext(ctx, &keys, `SELECT DISTINCT 0 AS member_id, target_id, type, emotion FROM following WHERE member_id = ?;`, memberID); err != nil {
+			return err
+		}
+		for _, step := range []struct {
+			query string
+			args  []interface{}
+			count *int
+		}{
+			{`DELETE FROM following WHERE member_id = ? AND emotion = 0;`, []interface{}{memberID}, &receipt.Follows},
+			{`DELETE FROM following WHERE member_id = ? AND emotion <> 0;`, []interface{}{memberID}, &receipt.Reactions},
+			// Detach deactivation rows of or about the member first, so a later reactivation can neither find them
+			// by the erased ID nor restore them as follows of member 0
+			{`UPDATE following_archive SET cause_id = NULL WHERE reason = ? AND (cause_id = ? OR member_id = ? OR (type = ? AND target_id = ?));`,
+				[]interface{}{deactivatedReason, memberID, memberID, member.FollowType, memberID}, nil},
+			{`UPDATE following_archive SET member_id = 0 WHERE member_id = ?;`, []interface{}{memberID}, &receipt.Anonymized},
+			{`UPDATE following_archive SET target_id = 0 WHERE type = ? AND target_id = ?;`, []interface{}{member.FollowType, memberID}, &anonymizedTargets},
+			{`DELETE FROM member_blocks WHERE member_id = ? OR blocked_id = ?;`, []interface{}{memberID, memberID}, &receipt.Blocks},
+		} {
+			result, err := tx.ExecContext(ctx, step.query, step.args...)
+			if err != nil {
+				return err
+			}
+			changed, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if step.count != nil {
+				*step.count = int(changed)
+			}
+		}
+		receipt.Anonymized += anonymizedTargets
+		for _, k := range keys {
+			if err := recountCounter(ctx, tx, k); err != nil {
+				return err
+			}
+		}
+		_, err := tx.NamedExecContext(ctx, `INSERT INTO erasure_receipts (receipt_id, follows, reactions, anonymized, blocks, erased_at) 
+		VALUES (:receipt_id, :follows, :reactions, :anonymized, :blocks, :erased_at);`, receipt)
+		return err
+	})
+	if err != nil {
+		return ErasureReceipt{}, err
+	}
+	return receipt, nil
+}
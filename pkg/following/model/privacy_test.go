@@ -0,0 +1,68 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEraseMember(t *testing.T) {
+	member, err := registry.Get("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := mockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT DISTINCT 0 AS member_id, target_id, type, emotion FROM following WHERE member_id = \?;`).
+		WithArgs(70).
+		WillReturnRows(sqlmock.NewRows([]string{"member_id", "target_id", "type", "emotion"}))
+	mock.ExpectExec(`DELETE FROM following WHERE member_id = \? AND emotion = 0;`).WithArgs(70).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`DELETE FROM following WHERE member_id = \? AND emotion <> 0;`).WithArgs(70).WillReturnResult(sqlmock.NewResult(0, 1))
+	// Deactivation rows caused by or involving the member are detached before anonymizing
+	mock.ExpectExec(`UPDATE following_archive SET cause_id = NULL WHERE reason = \? AND \(cause_id = \? OR member_id = \? OR \(type = \? AND target_id = \?\)\);`).
+		WithArgs(deactivatedReason, 70, 70, member.FollowType, 70).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec(`UPDATE following_archive SET member_id = 0 WHERE member_id = \?;`).WithArgs(70).WillReturnResult(sqlmock.NewResult(0, 3))
+	// Archived follows of the member keep no trace of them either
+	mock.ExpectExec(`UPDATE following_archive SET target_id = 0 WHERE type = \? AND target_id = \?;`).
+		WithArgs(member.FollowType, 70).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(`DELETE FROM member_blocks WHERE member_id = \? OR blocked_id = \?;`).WithArgs(70, 70).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO erasure_receipts \(receipt_id, follows, reactions, anonymized, blocks, erased_at\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	receipt, err := new(followingAPI).EraseMember(context.Background(), 70)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, receipt.Follows)
+	assert.Equal(t, 1, receipt.Reactions)
+	assert.Equal(t, 7, receipt.Anonymized)
+	assert.Equal(t, 2, receipt.Blocks)
+	assert.Len(t, receipt.ReceiptID, 32)
+}
+
+func TestExportMemberBlocks(t *testing.T) {
+	blockedAt := time.Date(2020, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	mock := mockDB(t)
+	mock.ExpectQuery(`FROM following WHERE member_id = \?`).WithArgs(70).
+		WillReturnRows(sqlmock.NewRows([]string{"member_id", "target_id", "type", "emotion", "created_at"}))
+	mock.ExpectQuery(`FROM following_archive WHERE member_id = \?`).WithArgs(70).
+		WillReturnRows(sqlmock.NewRows([]string{"member_id", "target_id", "type", "emotion", "created_at", "archived_at", "reason"}))
+	mock.ExpectQuery(`SELECT blocked_id, created_at FROM member_blocks WHERE member_id = \?`).WithArgs(70).
+		WillReturnRows(sqlmock.NewRows([]string{"blocked_id", "created_at"}).AddRow(72, blockedAt))
+
+	export, err := new(followingAPI).ExportMember(context.Background(), 70)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, export.WriteCSV(&buf))
+	assert.Equal(t, "section,member_id,resource,target_id,emotion,created_at,archived_at,reason\n"+
+		"blocks,70,member,72,,2020-05-01T08:00:00Z,,\n", buf.String())
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+	"github.com/readr-media/readr-restful-following/internal/utils"
+)
+
+// ResolveURL maps a readr URL to the resource and target ID to follow with utils.ParseResourceInfo.
+// Resources whose URLs end in the Resource.URLSlug are addressed by slug, which is looked up in their table.
+func ResolveURL(ctx context.Context, url string) (resource string, id int64, err error) {
+	resource, key := utils.ParseResourceInfo(url)
+	if resource == "" || key == "" {
+		return "", 0, errors.New("Invalid Resource URL")
+	}
+	res, err := registry.Get(resource)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if !slugKeyed(res) {
+		if id, err = strconv.ParseInt(key, 10, 64); err != nil {
+			return "", 0, errors.New("Invalid Resource URL")
+		}
+		return resource, id, nil
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ? LIMIT 1;", res.PrimaryKey, res.Table, res.URLSlug)
+	if err = rrsql.DB.GetContext(ctx, &id, query, key); err == sql.ErrNoRows {
+		return "", 0, rrsql.TargetNotFoundError
+	} else if err != nil {
+		return "", 0, err
+	}
+	return resource, id, nil
+}
+
+// slugKeyed reports whether the last segment of res URLs is the slug rather than the ID,
+// going by the same utils.GenerateResourceInfo that builds them
+func slugKeyed(res registry.Resource) bool {
+	const probe = "slug"
+	return res.URLSlug != "" && strings.HasSuffix(utils.GenerateResourceInfo(res.Name, 0, probe), "/"+probe)
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFollowingVisibility(t *testing.T) {
+	project, err := registry.Get("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := []string{"type", "target_id", "created_at"}
+
+	for _, tc := range []struct {
+		name   string
+		viewer int64
+		hidden bool
+	}{
+		{"Anonymous", 0, true},
+		{"OtherMember", 72, true},
+		{"Owner", 71, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := mockDB(t)
+			if tc.hidden {
+				// Private follows of 71 are left out for anyone else
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE f.type IN (?) AND f.member_id = ? AND f.emotion = ? AND f.visibility = ? ORDER BY")).
+					WithArgs(project.FollowType, 71, 0, visibility("public")).
+					WillReturnRows(sqlmock.NewRows(columns))
+			} else {
+				mock.ExpectQuery(regexp.QuoteMeta("WHERE f.type IN (?) AND f.member_id = ? AND f.emotion = ? ORDER BY")).
+					WithArgs(project.FollowType, 71, 0).
+					WillReturnRows(sqlmock.NewRows(columns))
+			}
+			args := &GetFollowingArgs{MemberID: 71, Resources: []string{"project"}}
+			args.SetViewer(tc.viewer)
+			rows, err := args.get(context.Background())
+			if assert.NoError(t, err) {
+				rows.Close()
+			}
+		})
+	}
+}
+
+func TestGetFollowersVisibility(t *testing.T) {
+	mock := mockDB(t)
+	// Only public followers and the viewer themselves are listed
+	mock.ExpectQuery(regexp.QuoteMeta("f.target_id = ? AND f.type = ? AND f.emotion = ? AND (f.visibility = ? OR f.member_id = ?)")).
+		WithArgs(840, 3, 0, visibility("public"), 72, 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"member_id", "created_at"}))
+
+	args := &GetFollowersArgs{ID: 840, Resource: Resource{ResourceName: "project", FollowType: 3, MaxResult: 20, Page: 1}}
+	args.SetViewer(72)
+	rows, err := args.get(context.Background())
+	if assert.NoError(t, err) {
+		rows.Close()
+	}
+}
@@ -0,0 +1,122 @@
+package router
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/logger"
+	"github.com/readr-media/readr-restful-following/pkg/following/model"
+)
+
+type adminHandler struct{}
+
+// adminAuth requires the admin.token as bearer token. Without a configured token
+// the admin routes are disabled, so they are never open by default.
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := config.Current().Admin.Token
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"Error": "Admin API Disabled"})
+			return
+		}
+		given := c.GetHeader("Authorization")
+		if !strings.HasPrefix(given, "Bearer ") || subtle.ConstantTimeCompare([]byte(given[len("Bearer "):]), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func bindMemberID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Bad Member ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// ExportMember returns all follow data of a member as JSON, or as CSV with format=csv
+func (r *adminHandler) ExportMember(c *gin.Context) {
+	id, ok := bindMemberID(c)
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Unsupported Format"})
+		return
+	}
+
+	export, err := model.FollowingAPI.ExportMember(c.Request.Context(), id)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).WithError(err).WithField("member_id", id).Error("Export member error")
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+		return
+	}
+	if format == "csv" {
+		c.Header("Content-Disposition", "attachment; filename=member-"+c.Param("id")+"-follows.csv")
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err = export.WriteCSV(c.Writer); err != nil {
+			logger.FromContext(c.Request.Context()).WithError(err).Error("Write member export error")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"_items": export})
+}
+
+// EraseMember deletes the follow data of a member and returns the erasure receipt
+func (r *adminHandler) EraseMember(c *gin.Context) {
+	id, ok := bindMemberID(c)
+	if !ok {
+		return
+	}
+	receipt, err := model.FollowingAPI.EraseMember(c.Request.Context(), id)
+	if err != nil {
+		logger.FromContext(c.Request.Context()).WithError(err).WithField("member_id", id).Error("Erase member error")
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+		return
+	}
+	logger.FromContext(c.Request.Context()).WithField("receipt_id", receipt.ReceiptID).Info("Erased member follows")
+	c.JSON(http.StatusOK, gin.H{"_items": receipt})
+}
+
+// MergeMember moves the follows of the member given as source in the body into member :id.
+// With dry_run in the body it only reports what the merge would change.
+func (r *adminHandler) MergeMember(c *gin.Context) {
+	id, ok := bindMemberID(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Source int64 `json:"source" binding:"required"`
+		DryRun bool  `json:"dry_run"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Source <= 0 || body.Source == id {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Bad Member ID"})
+		return
+	}
+
+	report, err := model.FollowingAPI.MergeMember(c.Request.Context(), model.MergeArgs{Source: body.Source, Target: id, DryRun: body.DryRun})
+	if err != nil {
+		logger.FromContext(c.Request.Context()).WithError(err).WithField("source", body.Source).WithField("target", id).Error("Merge member error")
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"_items": report})
+}
+
+func (r *adminHandler) SetRoutes(router *gin.Engine) {
+	admin := router.Group("/admin", adminAuth())
+	admin.GET("/members/:id/follows", r.ExportMember)
+	admin.DELETE("/members/:id/follows", r.EraseMember)
+	admin.POST("/members/:id/merge", r.MergeMember)
+}
+
+var AdminRouter adminHandler
@@ -1,26 +1,40 @@
 package router
 
 import (
-	"fmt"
-	"log"
-
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/logger"
+	"github.com/readr-media/readr-restful-following/internal/metrics"
+	"github.com/readr-media/readr-restful-following/internal/registry"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
+	"github.com/readr-media/readr-restful-following/internal/tracing"
 	"github.com/readr-media/readr-restful-following/pkg/following/model"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var supportedAction = map[string]bool{
 	"follow":         true,
 	"unfollow":       true,
+	"set_visibility": true,
 	"insert_emotion": true,
 	"update_emotion": true,
 	"delete_emotion": true,
 	"post_comment":   true,
 	"edit_comment":   true,
 	"delete_comment": true,
+
+	"deactivate_member": true,
+	"reactivate_member": true,
+	"delete_member":     true,
+	"block_member":      true,
+	"unblock_member":    true,
 }
 
 type PubsubMessageMetaBody struct {
@@ -34,11 +48,22 @@ type PubsubMessageMeta struct {
 	Message      PubsubMessageMetaBody
 }
 
+// PubsubFollowMsgBody names the target by resource and object, or by its readr URL instead
 type PubsubFollowMsgBody struct {
 	Resource string `json:"resource"`
 	Emotion  string `json:"emotion"`
 	Subject  int    `json:"subject"`
 	Object   int    `json:"object"`
+	URL      string `json:"url,omitempty"`
+	// Visibility is a models.follow_visibility name, public when empty
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// PubsubMemberMsgBody is the member whose state changed in a member message,
+// or who blocks or unblocks Blocked
+type PubsubMemberMsgBody struct {
+	ID      int64 `json:"id"`
+	Blocked int64 `json:"blocked,omitempty"`
 }
 
 type pubsubHandler struct{}
@@ -53,6 +78,35 @@ func (r *pubsubHandler) Push(c *gin.Context) {
 	msgType := input.Message.Attr["type"]
 	actionType := input.Message.Attr["action"]
 
+	// Continue the publisher's trace when the message attributes carry a traceparent,
+	// otherwise stay under the push request span.
+	ctx := c.Request.Context()
+	if _, ok := input.Message.Attr["traceparent"]; ok {
+		ctx = tracing.Extract(ctx, input.Message.Attr)
+	}
+	ctx, span := tracing.Start(ctx, "pubsub.push",
+		attribute.String("messaging.message_id", input.Message.ID),
+		attribute.String("pubsub.type", msgType),
+		attribute.String("pubsub.action", actionType),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	// Carry the Pub/Sub messageId into every log line of this message, down to the model layer
+	ctx = logger.WithFields(ctx, logrus.Fields{"message_id": input.Message.ID, "type": msgType, "action": actionType})
+	log := logger.FromContext(ctx)
+
+	// result is the pubsub_messages_total label, overwritten on each failure path
+	result := "ok"
+	defer func() {
+		if !supportedAction[actionType] && !supportedAction[actionType+"_"+msgType] {
+			actionType = "unsupported"
+		}
+		if msgType != "follow" && msgType != "emotion" && msgType != "member" {
+			msgType = "unsupported"
+		}
+		metrics.PubsubMessages.WithLabelValues(msgType, actionType, result).Inc()
+	}()
+
 	switch msgType {
 	case "follow", "emotion":
 
@@ -60,80 +114,161 @@ func (r *pubsubHandler) Push(c *gin.Context) {
 
 		err = json.Unmarshal(input.Message.Body, &body)
 		if err != nil {
-			log.Printf("Parse msg body fail: %v \n", err.Error())
+			log.WithError(err).Warn("Parse msg body fail")
+			result = "bad_request"
 			c.JSON(http.StatusOK, gin.H{"Error": "Bad Request"})
 			return
 		}
-		params := model.FollowArgs{Resource: body.Resource, Subject: int64(body.Subject), Object: int64(body.Object)}
-		if val, ok := config.Config.Models.FollowingType[body.Resource]; ok {
-			params.Type = val
-		} else {
-			c.JSON(http.StatusOK, gin.H{"Error": "Unsupported Resource"})
+		if result, err = applyFollow(ctx, msgType, actionType, body); err != nil {
+			c.JSON(http.StatusOK, gin.H{"Error": err.Error()})
 			return
 		}
 
-		if msgType == "follow" {
-
-			// Follow situation set Emotion to none.
-			if params.Emotion != 0 {
-				params.Emotion = 0
-			}
-
-			switch actionType {
-			case "follow":
-				err = model.FollowingAPI.Insert(params)
-			case "unfollow":
-				err = model.FollowingAPI.Delete(params)
-			default:
-				log.Println("Follow action Type Not Support", actionType)
-				c.JSON(http.StatusOK, gin.H{"Error": "Bad Request"})
-				return
-			}
+		c.Status(http.StatusOK)
 
-		} else if msgType == "emotion" {
+	case "member":
 
-			// Rule out member
-			if params.Resource == "member" {
-				c.JSON(http.StatusOK, gin.H{"Error": "Emotion Not Available For Member"})
-				return
-			}
-			if val, ok := config.Config.Models.Emotions[body.Emotion]; ok {
-				params.Emotion = val
-			} else {
-				c.JSON(http.StatusOK, gin.H{"Error": "Unsupported Emotion"})
-				return
-			}
+		var body PubsubMemberMsgBody
+		if err = json.Unmarshal(input.Message.Body, &body); err != nil || body.ID == 0 {
+			log.WithError(err).Warn("Parse msg body fail")
+			result = "bad_request"
+			c.JSON(http.StatusOK, gin.H{"Error": "Bad Request"})
+			return
+		}
+		if !supportedAction[actionType+"_"+msgType] {
+			log.Warn("Member action Type Not Support")
+			result = "bad_request"
+			c.JSON(http.StatusOK, gin.H{"Error": "Bad Request"})
+			return
+		}
 
-			switch actionType {
-			case "insert":
-				err = model.FollowingAPI.Insert(params)
-			case "update":
-				err = model.FollowingAPI.Update(params)
-			case "delete":
-				err = model.FollowingAPI.Delete(params)
-			default:
-				log.Printf("Emotion action Type %s Not Support", actionType)
+		var affected int
+		switch actionType {
+		case "block", "unblock":
+			if body.Blocked == 0 {
+				log.Warn("Parse msg body fail")
+				result = "bad_request"
 				c.JSON(http.StatusOK, gin.H{"Error": "Bad Request"})
 				return
 			}
+			affected, err = model.FollowingAPI.UpdateBlock(ctx, model.BlockArgs{Member: body.ID, Blocked: body.Blocked, Action: actionType})
+		default:
+			affected, err = model.FollowingAPI.UpdateMember(ctx, model.MemberArgs{ID: body.ID, Action: actionType})
 		}
-
+		metrics.FollowOperations.WithLabelValues("member", actionType+"_"+msgType, metrics.Outcome(err)).Inc()
 		if err != nil {
-			log.Printf("%s fail: %v\n", actionType, err.Error())
+			log.WithError(err).WithField("member_id", body.ID).Error("Pubsub member action fail")
+			result = "error"
 			c.JSON(http.StatusOK, gin.H{"Error": err.Error()})
 			return
 		}
-
+		log.WithField("member_id", body.ID).WithField("affected", affected).Info("Cascaded member follows")
 		c.Status(http.StatusOK)
 
 	default:
-		log.Println("Pubsub Message Type Not Support", actionType)
-		fmt.Println(msgType)
+		log.Warn("Pubsub Message Type Not Support")
+		result = "unsupported_type"
 		c.Status(http.StatusOK)
 		return
 	}
 }
 
+// applyFollow applies a follow or emotion action to the target of body, which is given either
+// by resource and object or by a readr URL. result is the pubsub_messages_total label of the outcome.
+func applyFollow(ctx context.Context, msgType, actionType string, body PubsubFollowMsgBody) (result string, err error) {
+	log := logger.FromContext(ctx)
+
+	if body.URL != "" {
+		var object int64
+		if body.Resource, object, err = model.ResolveURL(ctx, body.URL); err != nil {
+			log.WithError(err).WithField("url", body.URL).Warn("Resolve resource URL fail")
+			return "bad_request", err
+		}
+		body.Object = int(object)
+	}
+
+	params := model.FollowArgs{Resource: body.Resource, Subject: int64(body.Subject), Object: int64(body.Object)}
+	res, err := registry.Get(body.Resource)
+	if err != nil {
+		return "unsupported_resource", err
+	}
+	params.Type = res.FollowType
+
+	if body.Visibility != "" {
+		if val, ok := config.Current().Models.FollowVisibility[body.Visibility]; ok {
+			params.Visibility = val
+		} else {
+			return "bad_request", errors.New("Unsupported Visibility")
+		}
+	}
+
+	if msgType == "follow" {
+
+		// Follow situation set Emotion to none.
+		if params.Emotion != 0 {
+			params.Emotion = 0
+		}
+
+		switch actionType {
+		case "follow":
+			err = model.FollowingAPI.Insert(ctx, params)
+		case "unfollow":
+			err = model.FollowingAPI.Delete(ctx, params)
+		case "set_visibility":
+			if body.Visibility == "" {
+				return "bad_request", errors.New("Unsupported Visibility")
+			}
+			err = model.FollowingAPI.SetVisibility(ctx, params)
+		default:
+			log.Warn("Follow action Type Not Support")
+			return "bad_request", errors.New("Bad Request")
+		}
+
+	} else if msgType == "emotion" {
+
+		// Rule out resources without emotions, e.g. member
+		if !res.Emotion {
+			return "bad_request", errors.New("Emotion Not Available For " + strings.Title(res.Name))
+		}
+		if val, ok := config.Current().Models.Emotions[body.Emotion]; ok {
+			params.Emotion = val
+		} else {
+			return "bad_request", errors.New("Unsupported Emotion")
+		}
+
+		switch actionType {
+		case "insert":
+			err = model.FollowingAPI.Insert(ctx, params)
+		case "update":
+			err = model.FollowingAPI.Update(ctx, params)
+		case "delete":
+			err = model.FollowingAPI.Delete(ctx, params)
+		default:
+			log.Warn("Emotion action Type Not Support")
+			return "bad_request", errors.New("Bad Request")
+		}
+	}
+
+	// Name operations the same way as supportedAction
+	operation := actionType
+	if msgType == "emotion" {
+		operation = actionType + "_" + msgType
+	}
+	metrics.FollowOperations.WithLabelValues(params.Resource, operation, metrics.Outcome(err)).Inc()
+
+	if err == rrsql.TargetNotFoundError {
+		log.WithField("resource", params.Resource).WithField("object", params.Object).Warn("Follow target not found")
+		return "not_found", err
+	} else if err == rrsql.BlockedError {
+		log.WithField("object", params.Object).Warn("Follow blocked by member")
+		return "blocked", err
+	} else if err != nil {
+		log.WithError(err).WithField("resource", params.Resource).Error("Pubsub action fail")
+		return "error", err
+	}
+	return "ok", nil
+}
+
 func (r *pubsubHandler) SetRoutes(router *gin.Engine) {
 	router.POST("/restful/pubsub", r.Push)
 }
@@ -3,14 +3,20 @@ package router
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/readr-media/readr-restful-following/config"
+	"github.com/readr-media/readr-restful-following/internal/logger"
+	"github.com/readr-media/readr-restful-following/internal/registry"
 	"github.com/readr-media/readr-restful-following/internal/rrsql"
+	"github.com/readr-media/readr-restful-following/internal/tracing"
 	"github.com/readr-media/readr-restful-following/pkg/following/model"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type followingHandler struct{}
@@ -39,7 +45,30 @@ func bindFollow(c *gin.Context) (result interface{}, err error) {
 			}
 		}
 
-		params.Active = map[string][]int{"$in": []int{1}}
+		if c.Query("active") != "" {
+			if err = json.Unmarshal([]byte(c.Query("active")), &params.Active); err != nil {
+				return nil, errors.New("Invalid Active Status")
+			}
+		}
+		if len(params.Active) == 0 {
+			params.Active = map[string][]int{"$in": []int{1}}
+		}
+		if c.Query("publish_status") != "" {
+			if err = json.Unmarshal([]byte(c.Query("publish_status")), &params.PublishStatus); err != nil {
+				return nil, errors.New("Invalid Publish Status")
+			}
+		}
+		if err = bindFilter(c, &params.Filter, model.FollowingFilterFields); err != nil {
+			return nil, err
+		}
+		if params.Sort != "" {
+			if _, err = model.OrderBy(params.Sort, model.FollowingSortFields); err != nil {
+				return nil, err
+			}
+		}
+		if err = params.EmbedArgs.Validate(); err != nil {
+			return nil, err
+		}
 
 		err = json.Unmarshal([]byte(params.ResourceName), &params.Resources)
 		if err != nil {
@@ -47,9 +76,21 @@ func bindFollow(c *gin.Context) (result interface{}, err error) {
 		}
 
 		for _, resName := range params.Resources {
-			if !validateFollowType(resName) {
+			res, err := registry.Get(resName)
+			if err != nil {
 				return nil, errors.New("Bad Following Type")
 			}
+			// Status values are checked against each resource's own enumeration
+			if res.ActiveColumn != "" {
+				if err = rrsql.ValidateActive(params.Active, res.Actives); err != nil {
+					return nil, err
+				}
+			}
+			if len(params.PublishStatus) > 0 && res.PublishColumn != "" {
+				if err = rrsql.ValidateActive(params.PublishStatus, res.PublishStatuses); err != nil {
+					return nil, err
+				}
+			}
 		}
 
 		if params.MemberID == 0 {
@@ -74,38 +115,158 @@ func bindFollow(c *gin.Context) (result interface{}, err error) {
 				}
 			}
 		}
-		params.Table, params.PrimaryKey, params.FollowType, err = rrsql.GetResourceMetadata(params.ResourceName)
+		res, err := registry.Get(params.ResourceName)
 		if err != nil {
 			return nil, err
 		}
+		params.Table, params.PrimaryKey, params.FollowType = res.Table, res.PrimaryKey, res.FollowType
 		if len(params.IDs) == 0 {
 			return nil, errors.New("Bad Resource ID")
 		}
+		if err = bindFilter(c, &params.Filter, model.FollowedFilterFields); err != nil {
+			return nil, err
+		}
+		if params.Sort != "" {
+			if _, err = model.OrderBy(params.Sort, model.FollowedSortFields); err != nil {
+				return nil, err
+			}
+		}
+		if err = params.EmbedArgs.Validate(); err != nil {
+			return nil, err
+		}
+		if params.FollowerLimit < 0 {
+			return nil, errors.New("Invalid Follower Limit")
+		}
+		if params.FollowerLimit > model.MaxFollowerLimit {
+			params.FollowerLimit = model.MaxFollowerLimit
+		}
 		// Only parse emotion parameter in resource
-		if c.Query("emotion") != "" {
+		if params.Emotion, err = bindEmotion(c, res); err != nil {
+			return nil, err
+		}
+		result = params
 
-			if c.Query("resource") != "member" {
-				if val, ok := config.Config.Models.Emotions[c.Query("emotion")]; ok {
-					params.Emotion = val
-				} else {
-					return nil, errors.New("Unsupported Emotion")
-				}
-			} else {
-				return nil, errors.New("Emotion Not Available For Member")
+	case "followers":
+
+		var params = &model.GetFollowersArgs{}
+		if err = c.Bind(params); err != nil {
+			return nil, err
+		}
+		res, err := registry.Get(params.ResourceName)
+		if err != nil {
+			return nil, err
+		}
+		params.FollowType = res.FollowType
+		if params.ID == 0 {
+			return nil, errors.New("Bad Resource ID")
+		}
+		if params.Emotion, err = bindEmotion(c, res); err != nil {
+			return nil, err
+		}
+		if params.MaxResult <= 0 {
+			params.MaxResult = 20
+		}
+		if params.Page <= 0 {
+			params.Page = 1
+		}
+		result = params
+
+	case "leaderboard":
+
+		var params = &model.GetLeaderboardArgs{}
+		if err = c.Bind(params); err != nil {
+			return nil, err
+		}
+		res, err := registry.Get(params.ResourceName)
+		if err != nil {
+			return nil, err
+		}
+		if params.Emotion, err = bindEmotion(c, res); err != nil {
+			return nil, err
+		}
+		if params.ResourceType != "" {
+			if _, ok := res.TypeValue(params.ResourceType); !ok {
+				return nil, errors.New("Invalid Resource Type")
 			}
 		}
+		if params.Window = c.Query("window"); params.Window != "" {
+			window, err := parseWindow(params.Window)
+			if err != nil {
+				return nil, err
+			}
+			params.Since = time.Now().Add(-window)
+		}
+		maxResult := config.Current().Leaderboard.MaxResult
+		if params.MaxResult <= 0 {
+			params.MaxResult = 20
+		}
+		if maxResult > 0 && params.MaxResult > maxResult {
+			params.MaxResult = maxResult
+		}
 		result = params
+
 	default:
 		return nil, errors.New("Unsupported Method")
 	}
 	return result, nil
 }
 
-func validateFollowType(resourceName string) bool {
-	if _, ok := config.Config.Models.FollowingType[resourceName]; !ok {
-		return false
+// viewerID is the member ID the gateway forwards in privacy.viewer_header, 0 if there is none
+func viewerID(c *gin.Context) int64 {
+	header := config.Current().Privacy.ViewerHeader
+	if header == "" {
+		return 0
+	}
+	id, err := strconv.ParseInt(c.GetHeader(header), 10, 64)
+	if err != nil || id <= 0 {
+		return 0
 	}
-	return true
+	return id
+}
+
+// bindEmotion parses the emotion parameter, defaulting to follow, for resources that support it
+func bindEmotion(c *gin.Context, res registry.Resource) (int, error) {
+	emotion := c.Query("emotion")
+	if emotion == "" || emotion == "follow" {
+		return config.Current().Models.Emotions["follow"], nil
+	}
+	if !res.Emotion {
+		return 0, errors.New("Emotion Not Available For " + strings.Title(res.Name))
+	}
+	if val, ok := config.Current().Models.Emotions[emotion]; ok {
+		return val, nil
+	}
+	return 0, errors.New("Unsupported Emotion")
+}
+
+// parseWindow accepts time.ParseDuration formats plus whole days, e.g. "24h" or "7d"
+func parseWindow(window string) (time.Duration, error) {
+	var (
+		d   time.Duration
+		err error
+	)
+	if strings.HasSuffix(window, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(window, "d"))
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(window)
+	}
+	if err != nil || d <= 0 {
+		return 0, errors.New("Invalid Window")
+	}
+	return d, nil
+}
+
+// bindFilter parses the filter query parameter, if any, and validates it against fields
+func bindFilter(c *gin.Context, filter *rrsql.Filter, fields map[string]string) error {
+	if c.Query("filter") != "" {
+		if err := json.Unmarshal([]byte(c.Query("filter")), filter); err != nil {
+			return errors.New("Invalid Filter")
+		}
+	}
+	_, _, err := filter.Conditions(fields)
+	return err
 }
 
 func (r *followingHandler) Get(c *gin.Context) {
@@ -114,22 +275,34 @@ func (r *followingHandler) Get(c *gin.Context) {
 		input, result interface{}
 		err           error
 	)
-	if input, err = bindFollow(c); err != nil {
+	_, span := tracing.Start(c.Request.Context(), "bindFollow", attribute.String("method", c.Param("method")))
+	input, err = bindFollow(c)
+	tracing.End(span, err)
+	if err != nil {
 		switch err.Error() {
 		case "Unsupported Method":
 			c.JSON(http.StatusNotFound, gin.H{"Error": err.Error()})
 		default:
-			log.Println("bindFollow", err)
+			logger.FromContext(c.Request.Context()).WithError(err).Warn("bindFollow")
 			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
 		}
 		return
 	}
 
+	// Only the gateway identifies the member asking, so the viewer is never taken from the query
+	if v, ok := input.(interface{ SetViewer(int64) }); ok {
+		v.SetViewer(viewerID(c))
+	}
+
 	switch input := input.(type) {
 	case *model.GetFollowingArgs:
-		result, err = model.FollowingAPI.Get(input)
+		result, err = model.FollowingAPI.Get(c.Request.Context(), input)
 	case *model.GetFollowedArgs:
-		result, err = model.FollowingAPI.Get(input)
+		result, err = model.FollowingAPI.Get(c.Request.Context(), input)
+	case *model.GetLeaderboardArgs:
+		result, err = model.FollowingAPI.Get(c.Request.Context(), input)
+	case *model.GetFollowersArgs:
+		result, err = model.FollowingAPI.Get(c.Request.Context(), input)
 	default:
 		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Cannot Found Proper API"})
 		return
@@ -137,7 +310,7 @@ func (r *followingHandler) Get(c *gin.Context) {
 	if err != nil {
 
 		switch err.Error() {
-		case "Unsupported Resource", "Invalid Post Type":
+		case "Unsupported Resource", "Invalid Resource Type":
 			c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
@@ -147,8 +320,50 @@ func (r *followingHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"_items": result})
 }
 
+type followURLBody struct {
+	URL     string `json:"url" binding:"required"`
+	Emotion string `json:"emotion"`
+	// Visibility is public or private, for follow and set_visibility
+	Visibility string `json:"visibility"`
+}
+
+// FollowByURL applies follow, unfollow, set_visibility or {insert,update,delete}_emotion to the target of a readr URL,
+// the same way as the pubsub messages do, on behalf of the member the gateway forwards in privacy.viewer_header
+func (r *followingHandler) FollowByURL(c *gin.Context) {
+	subject := viewerID(c)
+	if subject == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"Error": "Unauthorized"})
+		return
+	}
+	var body followURLBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Bad Request"})
+		return
+	}
+
+	msgType, actionType := "follow", c.Param("action")
+	if strings.HasSuffix(actionType, "_emotion") {
+		msgType, actionType = "emotion", strings.TrimSuffix(actionType, "_emotion")
+	}
+
+	result, err := applyFollow(c.Request.Context(), msgType, actionType, PubsubFollowMsgBody{URL: body.URL, Subject: int(subject), Emotion: body.Emotion, Visibility: body.Visibility})
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case err == rrsql.TargetNotFoundError:
+		c.JSON(http.StatusNotFound, gin.H{"Error": err.Error()})
+	case err == rrsql.BlockedError:
+		c.JSON(http.StatusForbidden, gin.H{"Error": err.Error()})
+	case result == "error" && err != rrsql.DuplicateError && err != rrsql.SQLUpdateFail:
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+	}
+}
+
 func (r *followingHandler) SetRoutes(router *gin.Engine) {
 	router.GET("/following/:method", r.Get)
+	router.POST("/following/url/:action", r.FollowByURL)
 }
 
 var Router followingHandler
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/readr-media/readr-restful-following/config"
 	"github.com/readr-media/readr-restful-following/internal/router"
+	"github.com/readr-media/readr-restful-following/internal/rrsql"
 	tc "github.com/readr-media/readr-restful-following/internal/test"
 	"github.com/readr-media/readr-restful-following/pkg/following/model"
 )
@@ -27,37 +29,100 @@ var mockFollowingDS = map[string][]followDS{
 	"project": []followDS{},
 }
 
-func (a *mockFollowingAPI) Get(params model.GetFollowInterface) (result interface{}, err error) {
+// lastViewer is the Viewer of the last following or followed query
+var lastViewer int64
+
+// lastSubject is the Subject of the last insert
+var lastSubject int64
+
+func (a *mockFollowingAPI) Get(ctx context.Context, params model.GetFollowInterface) (result interface{}, err error) {
 
 	switch params := params.(type) {
 	case *model.GetFollowingArgs:
+		lastViewer = params.Viewer
 		result, err = getFollowing(params)
 	case *model.GetFollowedArgs:
+		lastViewer = params.Viewer
 		result, err = getFollowed(params)
 	case *model.GetFollowerMemberIDsArgs:
 		result, err = getFollowerMemberIDs(params)
+	case *model.GetLeaderboardArgs:
+		result = []model.LeaderboardItem{}
+	case *model.GetFollowersArgs:
+		result = []model.FollowerItem{}
 	default:
 		return nil, errors.New("Unsupported Query Args")
 	}
 	return result, err
 }
 
-func (a *mockFollowingAPI) Insert(params model.FollowArgs) error {
+func (a *mockFollowingAPI) Insert(ctx context.Context, params model.FollowArgs) error {
 
 	store, ok := mockFollowingDS[params.Resource]
 	if !ok {
 		return errors.New("Resource Not Supported")
 	}
+	// Object 404 stands for a deleted target
+	if params.Object == 404 {
+		return rrsql.TargetNotFoundError
+	}
+	// Member 403 has blocked every follower
+	if params.Resource == "member" && params.Object == 403 {
+		return rrsql.BlockedError
+	}
 
+	lastSubject = params.Subject
 	store = append(store, followDS{ID: params.Subject, Object: params.Object})
 	return nil
 }
 
-func (a *mockFollowingAPI) Update(params model.FollowArgs) error {
+func (a *mockFollowingAPI) Update(ctx context.Context, params model.FollowArgs) error {
+	return nil
+}
+
+func (a *mockFollowingAPI) UpdateMember(ctx context.Context, params model.MemberArgs) (int, error) {
+	switch params.Action {
+	case "deactivate", "reactivate", "delete":
+		return 1, nil
+	}
+	return 0, errors.New("Unsupported Member Action")
+}
+
+func (a *mockFollowingAPI) ExportMember(ctx context.Context, memberID int64) (model.MemberExport, error) {
+	return model.MemberExport{
+		MemberID:   memberID,
+		Followings: []model.ExportItem{model.ExportItem{Resource: "post", TargetID: 84, Emotion: "follow"}},
+		Reactions:  []model.ExportItem{},
+		History:    []model.ExportItem{},
+	}, nil
+}
+
+func (a *mockFollowingAPI) EraseMember(ctx context.Context, memberID int64) (model.ErasureReceipt, error) {
+	return model.ErasureReceipt{ReceiptID: "receipt", MemberID: memberID, Follows: 1}, nil
+}
+
+func (a *mockFollowingAPI) MergeMember(ctx context.Context, params model.MergeArgs) (model.MergeReport, error) {
+	return model.MergeReport{Source: params.Source, Target: params.Target, Moved: 2, DryRun: params.DryRun}, nil
+}
+
+func (a *mockFollowingAPI) SetVisibility(ctx context.Context, params model.FollowArgs) error {
+	if _, ok := mockFollowingDS[params.Resource]; !ok {
+		return errors.New("Resource Not Supported")
+	}
 	return nil
 }
 
-func (a *mockFollowingAPI) Delete(params model.FollowArgs) error {
+func (a *mockFollowingAPI) UpdateBlock(ctx context.Context, params model.BlockArgs) (int, error) {
+	switch params.Action {
+	case "block":
+		return 2, nil
+	case "unblock":
+		return 0, nil
+	}
+	return 0, errors.New("Unsupported Block Action")
+}
+
+func (a *mockFollowingAPI) Delete(ctx context.Context, params model.FollowArgs) error {
 
 	store, ok := mockFollowingDS[params.Resource]
 	if !ok {
@@ -89,23 +154,23 @@ func getFollowed(args *model.GetFollowedArgs) (interface{}, error) {
 		return []model.FollowedCount{}, nil
 	case args.ResourceName == "member":
 		return []model.FollowedCount{
-			model.FollowedCount{71, 1, []int64{72}},
-			model.FollowedCount{72, 1, []int64{71}},
+			model.FollowedCount{ResourceID: 71, Count: 1, Followers: []int64{72}},
+			model.FollowedCount{ResourceID: 72, Count: 1, Followers: []int64{71}},
 		}, nil
 	case args.ResourceName == "post":
 		switch args.ResourceType {
 		case "":
 			return []model.FollowedCount{
-				model.FollowedCount{42, 2, []int64{71, 72}},
-				model.FollowedCount{84, 1, []int64{71}},
+				model.FollowedCount{ResourceID: 42, Count: 2, Followers: []int64{71, 72}},
+				model.FollowedCount{ResourceID: 84, Count: 1, Followers: []int64{71}},
 			}, nil
 		case "review":
 			return []model.FollowedCount{
-				model.FollowedCount{42, 2, []int64{71, 72}},
+				model.FollowedCount{ResourceID: 42, Count: 2, Followers: []int64{71, 72}},
 			}, nil
 		case "news":
 			return []model.FollowedCount{
-				model.FollowedCount{84, 1, []int64{71}},
+				model.FollowedCount{ResourceID: 84, Count: 1, Followers: []int64{71}},
 			}, nil
 		}
 		return nil, nil
@@ -113,12 +178,12 @@ func getFollowed(args *model.GetFollowedArgs) (interface{}, error) {
 		switch len(args.IDs) {
 		case 1:
 			return []model.FollowedCount{
-				model.FollowedCount{840, 1, []int64{72}},
+				model.FollowedCount{ResourceID: 840, Count: 1, Followers: []int64{72}},
 			}, nil
 		case 2:
 			return []model.FollowedCount{
-				model.FollowedCount{420, 2, []int64{71, 72}},
-				model.FollowedCount{840, 1, []int64{72}},
+				model.FollowedCount{ResourceID: 420, Count: 2, Followers: []int64{71, 72}},
+				model.FollowedCount{ResourceID: 840, Count: 1, Followers: []int64{72}},
 			}, nil
 		}
 		return nil, nil
@@ -138,12 +203,13 @@ func (m mockFollowCache) Revoke(actionType string, resource string, emotion int,
 
 func TestMain(m *testing.M) {
 
+	os.Setenv("READR_ADMIN_TOKEN", "admin-token")
 	_, err := config.LoadConfig("../../../config/main.json")
 	if err != nil {
 		panic(fmt.Errorf("Invalid application configuration: %s", err))
 	}
 
-	tc.SetRoutes([]router.RouterHandler{&Router, &PubsubRouter})
+	tc.SetRoutes([]router.RouterHandler{&Router, &PubsubRouter, &AdminRouter})
 
 	model.FollowingAPI = new(mockFollowingAPI)
 
@@ -175,12 +241,24 @@ func TestFollowing(t *testing.T) {
 			tc.GenericTestcase{"FollowingPostReviewOK", "GET", `/following/user?resource=post&resource_type=review&id=71`, ``, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowingPostNewsOK", "GET", `/following/user?resource=post&resource_type=news&id=71`, ``, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowingProjectOK", "GET", `/following/user?resource=project&id=71`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowingMultipleResWithType", "GET", `/following/user?resource=["post", "project"]&resource_type=wip&id=71`, ``, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowingWithTargetIDsOK", "GET", `/following/user?resource=project&id=71&target_ids=[1,2,3]`, ``, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowingWithModeIDOK", "GET", `/following/user?resource=project&id=71&mode=id`, ``, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowingMultipleRes", "GET", `/following/user?resource=["post", "project"]&id=71`, ``, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowingMaxresultPaging", "GET", `/following/user?resource=["post", "project"]&id=71&max_result=1&page=2`, ``, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowingBadID", "GET", `/following/user?resource=post&max_result=1`, ``, http.StatusBadRequest, `{"Error":"Bad Resource ID"}`},
 			tc.GenericTestcase{"FollowingBadType", "GET", `/following/user?resource=["post", "aaa"]&id=71`, ``, http.StatusBadRequest, `{"Error":"Bad Following Type"}`},
+			tc.GenericTestcase{"FollowingActivePublishOK", "GET", `/following/user?resource=["post", "project"]&id=71&active={"$in":[1]}&publish_status={"$in":[2]}`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowingFilterOK", "GET", `/following/user?resource=post&id=71&filter={"created_at":{"$gte":"2020-01-01"},"target_id":{"$nin":[1,2]}}`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowingFilterBadField", "GET", `/following/user?resource=post&id=71&filter={"member_id":{"$eq":1}}`, ``, http.StatusBadRequest, `{"Error":"Invalid Filter Field member_id"}`},
+			tc.GenericTestcase{"FollowingSortOK", "GET", `/following/user?resource=post&id=71&sort=created_at,-target_id`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowingEmbedMembersOK", "GET", `/following/user?resource=member&id=71&embed=members`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowingEmbedTargetOK", "GET", `/following/user?resource=["post","project","tag"]&id=71&embed=target,members`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowingEmbedURLOK", "GET", `/following/user?resource=["post","project"]&id=71&embed=url`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowingInvalidMemberField", "GET", `/following/user?resource=member&id=71&embed=members&member_fields=email`, ``, http.StatusBadRequest, `{"Error":"Invalid Member Field email"}`},
+			tc.GenericTestcase{"FollowingSortBadField", "GET", `/following/user?resource=post&id=71&sort=-count`, ``, http.StatusBadRequest, `{"Error":"Invalid Sort Field -count"}`},
+			tc.GenericTestcase{"FollowingInvalidActive", "GET", `/following/user?resource=post&id=71&active={"$in":[1,5]}`, ``, http.StatusBadRequest, `{"Error":"Not all active elements are valid"}`},
+			tc.GenericTestcase{"FollowingInvalidPublishStatus", "GET", `/following/user?resource=post&id=71&publish_status={"$in":[9]}`, ``, http.StatusBadRequest, `{"Error":"No valid active request"}`},
 
 			tc.GenericTestcase{"FollowedPostOK", "GET", `/following/resource?resource=post&ids=[42,84]&resource_type=news`, ``, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowedPostReviewOK", "GET", `/following/resource?resource=post&ids=[42,84]&resource_type=review`, ``, http.StatusOK, nil},
@@ -188,6 +266,18 @@ func TestFollowing(t *testing.T) {
 			tc.GenericTestcase{"FollowedMemberOK", "GET", `/following/resource?resource=member&ids=[42,84]`, ``, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowedProjectSingleOK", "GET", `/following/resource?resource=project&ids=[840]`, ``, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowedProjectOK", "GET", `/following/resource?resource=project&ids=[420,840]`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowedProjectStatusOK", "GET", `/following/resource?resource=project&ids=[420,840]&resource_type=done`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowedFilterOK", "GET", `/following/resource?resource=project&ids=[420,840]&filter={"created_at":{"$lt":"2020-01-01"}}`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowedFilterBadOperator", "GET", `/following/resource?resource=project&ids=[420,840]&filter={"created_at":{"$like":"2020"}}`, ``, http.StatusBadRequest, `{"Error":"Invalid Filter Operator $like"}`},
+			tc.GenericTestcase{"FollowedSortOK", "GET", `/following/resource?resource=project&ids=[420,840]&sort=-count`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowedSortBadField", "GET", `/following/resource?resource=project&ids=[420,840]&sort=member_id`, ``, http.StatusBadRequest, `{"Error":"Invalid Sort Field member_id"}`},
+			tc.GenericTestcase{"FollowedOmitFollowersOK", "GET", `/following/resource?resource=project&ids=[420,840]&omit_followers=true`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowedFollowerLimitOK", "GET", `/following/resource?resource=project&ids=[420,840]&follower_limit=10`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowedInvalidFollowerLimit", "GET", `/following/resource?resource=project&ids=[420,840]&follower_limit=-1`, ``, http.StatusBadRequest, `{"Error":"Invalid Follower Limit"}`},
+			tc.GenericTestcase{"FollowedEmbedMembersOK", "GET", `/following/resource?resource=project&ids=[420,840]&embed=members&member_fields=nickname,role`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowedEmbedURLOK", "GET", `/following/resource?resource=memo&ids=[420,840]&embed=url`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowedInvalidEmbed", "GET", `/following/resource?resource=project&ids=[420,840]&embed=comments`, ``, http.StatusBadRequest, `{"Error":"Invalid Embed comments"}`},
+			tc.GenericTestcase{"FollowedInvalidMemberField", "GET", `/following/resource?resource=project&ids=[420,840]&embed=members&member_fields=password`, ``, http.StatusBadRequest, `{"Error":"Invalid Member Field password"}`},
 			tc.GenericTestcase{"FollowedMissingResource", "GET", `/following/resource?ids=[420,840]`, ``, http.StatusBadRequest, `{"Error":"Unsupported Resource"}`},
 			tc.GenericTestcase{"FollowedMissingID", "GET", `/following/resource?resource=post&ids=[]`, ``, http.StatusBadRequest, `{"Error":"Bad Resource ID"}`},
 			tc.GenericTestcase{"FollowedPostNotExist", "GET", `/following/resource?resource=post&ids=[1000,1001]&resource_type=news`, ``, http.StatusOK, nil},
@@ -198,6 +288,51 @@ func TestFollowing(t *testing.T) {
 			tc.GenericDoTest(testcase, t, nil)
 		}
 	})
+	t.Run("Leaderboard", func(t *testing.T) {
+		for _, testcase := range []tc.GenericTestcase{
+			tc.GenericTestcase{"LeaderboardProjectOK", "GET", `/following/leaderboard?resource=project&window=7d&max_result=20`, ``, http.StatusOK, `{"_items":[]}`},
+			tc.GenericTestcase{"LeaderboardPostLikeOK", "GET", `/following/leaderboard?resource=post&emotion=like&window=24h&resource_type=review`, ``, http.StatusOK, `{"_items":[]}`},
+			tc.GenericTestcase{"LeaderboardAllTimeOK", "GET", `/following/leaderboard?resource=member`, ``, http.StatusOK, `{"_items":[]}`},
+			tc.GenericTestcase{"LeaderboardMissingResource", "GET", `/following/leaderboard?window=7d`, ``, http.StatusBadRequest, `{"Error":"Unsupported Resource"}`},
+			tc.GenericTestcase{"LeaderboardMemberEmotion", "GET", `/following/leaderboard?resource=member&emotion=like`, ``, http.StatusBadRequest, `{"Error":"Emotion Not Available For Member"}`},
+			tc.GenericTestcase{"LeaderboardInvalidEmotion", "GET", `/following/leaderboard?resource=post&emotion=angry`, ``, http.StatusBadRequest, `{"Error":"Unsupported Emotion"}`},
+			tc.GenericTestcase{"LeaderboardInvalidType", "GET", `/following/leaderboard?resource=post&resource_type=unknown`, ``, http.StatusBadRequest, `{"Error":"Invalid Resource Type"}`},
+			tc.GenericTestcase{"LeaderboardInvalidWindow", "GET", `/following/leaderboard?resource=post&window=-7d`, ``, http.StatusBadRequest, `{"Error":"Invalid Window"}`},
+		} {
+			tc.GenericDoTest(testcase, t, nil)
+		}
+	})
+	t.Run("Followers", func(t *testing.T) {
+		for _, testcase := range []tc.GenericTestcase{
+			tc.GenericTestcase{"FollowersPostOK", "GET", `/following/followers?resource=post&id=42&max_result=20&page=2`, ``, http.StatusOK, `{"_items":[]}`},
+			tc.GenericTestcase{"FollowersPostLikeOK", "GET", `/following/followers?resource=post&id=42&emotion=like`, ``, http.StatusOK, `{"_items":[]}`},
+			tc.GenericTestcase{"FollowersMissingID", "GET", `/following/followers?resource=post`, ``, http.StatusBadRequest, `{"Error":"Bad Resource ID"}`},
+			tc.GenericTestcase{"FollowersMissingResource", "GET", `/following/followers?id=42`, ``, http.StatusBadRequest, `{"Error":"Unsupported Resource"}`},
+			tc.GenericTestcase{"FollowersMemberEmotion", "GET", `/following/followers?resource=member&id=42&emotion=like`, ``, http.StatusBadRequest, `{"Error":"Emotion Not Available For Member"}`},
+		} {
+			tc.GenericDoTest(testcase, t, nil)
+		}
+	})
+	t.Run("Viewer", func(t *testing.T) {
+
+		for _, testcase := range []struct {
+			tc.GenericTestcase
+			header http.Header
+			viewer int64
+		}{
+			{tc.GenericTestcase{"FollowingQueryViewerIgnored", "GET", `/following/user?resource=project&id=71&viewer=71`, ``, http.StatusOK, nil}, nil, 0},
+			{tc.GenericTestcase{"FollowingHeaderViewer", "GET", `/following/user?resource=project&id=71`, ``, http.StatusOK, nil}, http.Header{"X-Readr-Member-Id": {"71"}}, 71},
+			{tc.GenericTestcase{"FollowingBadHeaderViewer", "GET", `/following/user?resource=project&id=71`, ``, http.StatusOK, nil}, http.Header{"X-Readr-Member-Id": {"abc"}}, 0},
+			{tc.GenericTestcase{"FollowedQueryViewerIgnored", "GET", `/following/resource?resource=project&ids=[42,84]&viewer=70`, ``, http.StatusOK, nil}, nil, 0},
+			{tc.GenericTestcase{"FollowedHeaderViewer", "GET", `/following/resource?resource=project&ids=[42,84]`, ``, http.StatusOK, nil}, http.Header{"X-Readr-Member-Id": {"70"}}, 70},
+		} {
+			lastViewer = -1
+			tc.GenericDoTestWithHeader(testcase.GenericTestcase, testcase.header, t, nil)
+			if lastViewer != testcase.viewer {
+				t.Errorf("%s want viewer %d but get %d", testcase.Name, testcase.viewer, lastViewer)
+			}
+		}
+	})
 	// It seems insert and delete shouldn't be tested here.
 	t.Run("Insert", func(t *testing.T) {
 
@@ -207,11 +342,101 @@ func TestFollowing(t *testing.T) {
 			tc.GenericTestcase{"FollowingProjectOK", "follow", `/restful/pubsub`, `{"resource":"project","subject":70,"object":840}`, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowingTagOK", "follow", `/restful/pubsub`, `{"resource":"tag","subject":70,"object":1}`, http.StatusOK, nil},
 			tc.GenericTestcase{"FollowingMissingResource", "follow", `/restful/pubsub`, `{"resource":"","subject":70,"object":72}`, http.StatusOK, `{"Error":"Unsupported Resource"}`},
+			tc.GenericTestcase{"FollowingMemberBlocked", "follow", `/restful/pubsub`, `{"resource":"member","subject":70,"object":403}`, http.StatusOK, `{"Error":"Blocked By Member"}`},
+			tc.GenericTestcase{"FollowingPostNotFound", "follow", `/restful/pubsub`, `{"resource":"post","subject":70,"object":404}`, http.StatusOK, `{"Error":"Target Not Found"}`},
+			tc.GenericTestcase{"FollowingPostURLOK", "follow", `/restful/pubsub`, `{"url":"https://www.readr.tw/post/84","subject":70}`, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowingInvalidURL", "follow", `/restful/pubsub`, `{"url":"https://www.readr.tw/about","subject":70}`, http.StatusOK, `{"Error":"Invalid Resource URL"}`},
+			tc.GenericTestcase{"FollowingPrivateOK", "follow", `/restful/pubsub`, `{"resource":"project","subject":70,"object":840,"visibility":"private"}`, http.StatusOK, nil},
+			tc.GenericTestcase{"FollowingInvalidVisibility", "follow", `/restful/pubsub`, `{"resource":"project","subject":70,"object":840,"visibility":"secret"}`, http.StatusOK, `{"Error":"Unsupported Visibility"}`},
+			tc.GenericTestcase{"SetVisibilityOK", "set_visibility", `/restful/pubsub`, `{"resource":"project","subject":70,"object":840,"visibility":"public"}`, http.StatusOK, nil},
+			tc.GenericTestcase{"SetVisibilityMissing", "set_visibility", `/restful/pubsub`, `{"resource":"project","subject":70,"object":840}`, http.StatusOK, `{"Error":"Unsupported Visibility"}`},
 			tc.GenericTestcase{"FollowingMissingAction", "", `/restful/pubsub`, `{"resource":"post","subject":70,"object":72}`, http.StatusOK, `{"Error":"Bad Request"}`},
 		} {
 			tc.GenericDoTest(transformPubsub(testcase), t, nil)
 		}
 	})
+	t.Run("Member", func(t *testing.T) {
+
+		transformMember := func(testcase tc.GenericTestcase) tc.GenericTestcase {
+			testcase = transformPubsub(testcase)
+			meta := testcase.Body.(PubsubMessageMeta)
+			meta.Message.Attr["type"] = "member"
+			testcase.Body = meta
+			return testcase
+		}
+		for _, testcase := range []tc.GenericTestcase{
+			tc.GenericTestcase{"DeactivateOK", "deactivate", `/restful/pubsub`, `{"id":70}`, http.StatusOK, nil},
+			tc.GenericTestcase{"ReactivateOK", "reactivate", `/restful/pubsub`, `{"id":70}`, http.StatusOK, nil},
+			tc.GenericTestcase{"DeleteOK", "delete", `/restful/pubsub`, `{"id":70}`, http.StatusOK, nil},
+			tc.GenericTestcase{"UnsupportedAction", "ban", `/restful/pubsub`, `{"id":70}`, http.StatusOK, `{"Error":"Bad Request"}`},
+			tc.GenericTestcase{"MissingID", "delete", `/restful/pubsub`, `{}`, http.StatusOK, `{"Error":"Bad Request"}`},
+			tc.GenericTestcase{"BlockOK", "block", `/restful/pubsub`, `{"id":70,"blocked":72}`, http.StatusOK, nil},
+			tc.GenericTestcase{"UnblockOK", "unblock", `/restful/pubsub`, `{"id":70,"blocked":72}`, http.StatusOK, nil},
+			tc.GenericTestcase{"BlockMissingBlocked", "block", `/restful/pubsub`, `{"id":70}`, http.StatusOK, `{"Error":"Bad Request"}`},
+		} {
+			tc.GenericDoTest(transformMember(testcase), t, nil)
+		}
+	})
+	t.Run("Admin", func(t *testing.T) {
+
+		for _, testcase := range []tc.GenericTestcase{
+			tc.GenericTestcase{"ExportJSONOK", "GET", `/admin/members/70/follows`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"ExportCSVOK", "GET", `/admin/members/70/follows?format=csv`, ``, http.StatusOK,
+				"section,member_id,resource,target_id,emotion,created_at,archived_at,reason\nfollowings,70,post,84,follow,,,\n"},
+			tc.GenericTestcase{"ExportUnsupportedFormat", "GET", `/admin/members/70/follows?format=xml`, ``, http.StatusBadRequest, `{"Error":"Unsupported Format"}`},
+			tc.GenericTestcase{"ExportBadID", "GET", `/admin/members/abc/follows`, ``, http.StatusBadRequest, `{"Error":"Bad Member ID"}`},
+			tc.GenericTestcase{"EraseOK", "DELETE", `/admin/members/70/follows`, ``, http.StatusOK, nil},
+			tc.GenericTestcase{"MergeOK", "POST", `/admin/members/70/merge`, `{"source":71}`, http.StatusOK,
+				`{"_items":{"source":71,"target":70,"moved":2,"duplicates":0,"rewritten":0,"rewrite_duplicates":0,"self_follows":0,"blocks":0,"blocked":0,"archived":0,"archive_duplicates":0}}`},
+			tc.GenericTestcase{"MergeDryRunOK", "POST", `/admin/members/70/merge`, `{"source":71,"dry_run":true}`, http.StatusOK,
+				`{"_items":{"source":71,"target":70,"moved":2,"duplicates":0,"rewritten":0,"rewrite_duplicates":0,"self_follows":0,"blocks":0,"blocked":0,"archived":0,"archive_duplicates":0,"dry_run":true}}`},
+			tc.GenericTestcase{"MergeSameMember", "POST", `/admin/members/70/merge`, `{"source":70}`, http.StatusBadRequest, `{"Error":"Bad Member ID"}`},
+			tc.GenericTestcase{"MergeMissingSource", "POST", `/admin/members/70/merge`, `{}`, http.StatusBadRequest, `{"Error":"Bad Member ID"}`},
+			tc.GenericTestcase{"EraseBadID", "DELETE", `/admin/members/0/follows`, ``, http.StatusBadRequest, `{"Error":"Bad Member ID"}`},
+		} {
+			tc.GenericDoTestWithHeader(testcase, http.Header{"Authorization": {"Bearer admin-token"}}, t, nil)
+		}
+		for _, testcase := range []struct {
+			tc.GenericTestcase
+			token string
+		}{
+			{tc.GenericTestcase{"ExportMissingToken", "GET", `/admin/members/70/follows`, ``, http.StatusUnauthorized, `{"Error":"Unauthorized"}`}, ""},
+			{tc.GenericTestcase{"EraseWrongToken", "DELETE", `/admin/members/70/follows`, ``, http.StatusUnauthorized, `{"Error":"Unauthorized"}`}, "Bearer guess"},
+			{tc.GenericTestcase{"MergeWrongToken", "POST", `/admin/members/70/merge`, `{"source":71}`, http.StatusUnauthorized, `{"Error":"Unauthorized"}`}, "admin-token"},
+		} {
+			tc.GenericDoTestWithHeader(testcase.GenericTestcase, http.Header{"Authorization": {testcase.token}}, t, nil)
+		}
+	})
+	t.Run("FollowByURL", func(t *testing.T) {
+
+		viewer := http.Header{"X-Readr-Member-Id": {"70"}}
+		for _, testcase := range []struct {
+			tc.GenericTestcase
+			header http.Header
+		}{
+			{tc.GenericTestcase{"FollowPostOK", "POST", `/following/url/follow`, `{"url":"https://www.readr.tw/post/84"}`, http.StatusOK, nil}, viewer},
+			{tc.GenericTestcase{"FollowPrivateOK", "POST", `/following/url/follow`, `{"url":"https://www.readr.tw/post/84","visibility":"private"}`, http.StatusOK, nil}, viewer},
+			{tc.GenericTestcase{"SetVisibilityOK", "POST", `/following/url/set_visibility`, `{"url":"https://www.readr.tw/post/84","visibility":"public"}`, http.StatusOK, nil}, viewer},
+			{tc.GenericTestcase{"UnfollowPostOK", "POST", `/following/url/unfollow`, `{"url":"https://www.readr.tw/post/84"}`, http.StatusOK, nil}, viewer},
+			{tc.GenericTestcase{"InsertEmotionOK", "POST", `/following/url/insert_emotion`, `{"url":"https://www.readr.tw/post/84","emotion":"like"}`, http.StatusOK, nil}, viewer},
+			{tc.GenericTestcase{"FollowPostNotFound", "POST", `/following/url/follow`, `{"url":"https://www.readr.tw/post/404"}`, http.StatusNotFound, `{"Error":"Target Not Found"}`}, viewer},
+			{tc.GenericTestcase{"InvalidEmotion", "POST", `/following/url/insert_emotion`, `{"url":"https://www.readr.tw/post/84","emotion":"angry"}`, http.StatusBadRequest, `{"Error":"Unsupported Emotion"}`}, viewer},
+			{tc.GenericTestcase{"InvalidAction", "POST", `/following/url/share`, `{"url":"https://www.readr.tw/post/84"}`, http.StatusBadRequest, `{"Error":"Bad Request"}`}, viewer},
+			{tc.GenericTestcase{"InvalidURL", "POST", `/following/url/follow`, `{"url":"https://www.readr.tw/post/"}`, http.StatusBadRequest, `{"Error":"Invalid Resource URL"}`}, viewer},
+			{tc.GenericTestcase{"MissingURL", "POST", `/following/url/follow`, `{}`, http.StatusBadRequest, `{"Error":"Bad Request"}`}, viewer},
+			{tc.GenericTestcase{"MissingViewer", "POST", `/following/url/follow`, `{"url":"https://www.readr.tw/post/84","subject":70}`, http.StatusUnauthorized, `{"Error":"Unauthorized"}`}, nil},
+			{tc.GenericTestcase{"BadViewer", "POST", `/following/url/follow`, `{"url":"https://www.readr.tw/post/84"}`, http.StatusUnauthorized, `{"Error":"Unauthorized"}`}, http.Header{"X-Readr-Member-Id": {"abc"}}},
+		} {
+			tc.GenericDoTestWithHeader(testcase.GenericTestcase, testcase.header, t, nil)
+		}
+
+		// A subject in the body does not override the gateway viewer
+		lastSubject = 0
+		tc.GenericDoTestWithHeader(tc.GenericTestcase{"SubjectFromViewer", "POST", `/following/url/follow`, `{"url":"https://www.readr.tw/post/84","subject":71}`, http.StatusOK, nil}, viewer, t, nil)
+		if lastSubject != 70 {
+			t.Errorf("SubjectFromViewer want subject 70 but get %d", lastSubject)
+		}
+	})
 	t.Run("Delete", func(t *testing.T) {
 
 		for _, testcase := range []tc.GenericTestcase{